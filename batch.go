@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/core"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+type bOptions struct {
+	in, out         string
+	inPlace         bool
+	jobs            int
+	recipe, command string
+}
+
+var defaultBatchOptions bOptions = bOptions{"", "", false, runtime.NumCPU(), "", ""}
+
+func bFlags(fs *flip.FlagSet, o *bOptions) *flip.FlagSet {
+	fs.StringVar(&o.in, "in", o.in, "A comma separated list of globs or directories of images to process")
+	fs.StringVar(&o.out, "out", o.out, "An out directory, or an out path template of {dir}, {name} and {ext} e.g. {name}_thumb.{ext}")
+	fs.BoolVar(&o.inPlace, "inPlace", o.inPlace, "Save over each image, in place of an -out")
+	fs.IntVar(&o.jobs, "jobs", o.jobs, "The number of images processed at once")
+	fs.StringVar(&o.recipe, "recipe", o.recipe, "The path of a recipe run against each image")
+	fs.StringVar(&o.command, "command", o.command, "A core command and its flags run against each image, e.g. 'resize -geometry 50%'")
+	return fs
+}
+
+var (
+	batchRecipeError = xrr.Xrror("batch needs one of -recipe or -command")
+	batchInError     = xrr.Xrror("batch needs images with -in")
+	batchMatchError  = xrr.Xrror("no images match %s").Out
+	batchOutError    = xrr.Xrror("batch needs an -out, or -inPlace to save over each image")
+	batchPlaceError  = xrr.Xrror("batch takes one of -out or -inPlace")
+	batchCollision   = xrr.Xrror("%s would be written to %s, as is %s").Out
+)
+
+// batchRecipe provides the recipe of the options, either read from the recipe
+// file or as the single step of the command.
+func batchRecipe(o *bOptions) (*core.Recipe, error) {
+	switch {
+	case o.recipe != "" && o.command == "":
+		return core.ReadRecipe(o.recipe)
+	case strings.TrimSpace(o.command) != "" && o.recipe == "":
+		f := strings.Fields(o.command)
+		return &core.Recipe{Steps: []core.Step{{Command: f[0], Args: f[1:]}}}, nil
+	}
+	return nil, batchRecipeError
+}
+
+// batchFiles provides the sorted images matched by each comma separated glob,
+// or contained in each comma separated directory.
+func batchFiles(in string) ([]string, error) {
+	if in == "" {
+		return nil, batchInError
+	}
+	has := make(map[string]bool)
+	var ret []string
+	for _, p := range strings.Split(in, ",") {
+		var m []string
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			fis, err := ioutil.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range fis {
+				m = append(m, filepath.Join(p, f.Name()))
+			}
+		} else {
+			if m, err = filepath.Glob(p); err != nil {
+				return nil, err
+			}
+		}
+		var n int
+		for _, f := range m {
+			if fi, err := os.Stat(f); err != nil || fi.IsDir() || !canvas.IsFileTypePath(f) {
+				continue
+			}
+			n++
+			if !has[f] {
+				has[f] = true
+				ret = append(ret, f)
+			}
+		}
+		if n == 0 {
+			return nil, batchMatchError(p)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// batchOut provides the out path of the in path by the out option, an empty
+// string saving over the in path.
+func batchOut(out, in string) string {
+	ext := filepath.Ext(in)
+	switch {
+	case out == "":
+		return ""
+	case strings.Contains(out, "{"):
+		return strings.NewReplacer(
+			"{dir}", filepath.Dir(in),
+			"{name}", strings.TrimSuffix(filepath.Base(in), ext),
+			"{ext}", strings.TrimPrefix(ext, "."),
+		).Replace(out)
+	}
+	return filepath.Join(out, filepath.Base(in))
+}
+
+// batchOuts provides the out path of each file by the options, an error where
+// neither or both of an out and in place are given, or where any out path is
+// that of another file, or of any other in file, as files are processed at once.
+func batchOuts(o *bOptions, files []string) ([]string, error) {
+	switch {
+	case o.out == "" && !o.inPlace:
+		return nil, batchOutError
+	case o.out != "" && o.inPlace:
+		return nil, batchPlaceError
+	}
+	by := make(map[string]string)
+	abs := func(p string) string {
+		a, err := filepath.Abs(p)
+		if err != nil {
+			return p
+		}
+		return a
+	}
+	for _, in := range files {
+		by[abs(in)] = in
+	}
+	ret := make([]string, len(files))
+	for i, in := range files {
+		p := batchOut(o.out, in)
+		to := p
+		if to == "" {
+			to = in
+		}
+		if prior, ok := by[abs(to)]; ok && prior != in {
+			return nil, batchCollision(in, to, prior)
+		}
+		by[abs(to)] = in
+		ret[i] = p
+	}
+	return ret, nil
+}
+
+type batchResult struct {
+	in, out string
+	err     error
+}
+
+func batchFile(o *Options, c context.Context, r *core.Recipe, in, out string) error {
+	if out != "" {
+		if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+			return err
+		}
+	}
+	cv, err := canvas.New(canvasConfig(o, in, out)...)
+	if err != nil {
+		return err
+	}
+	c = ctx.WithLog(c, o.Logger)
+	c = ctx.WithCanvas(c, cv)
+	c = ctx.WithGeometry(c, o.G)
+	c, err = r.Run(c, core.NewOptions(o.Logger, o.proc.Fonts()))
+	if err != nil {
+		return err
+	}
+	return saveCanvas(o, ctx.Canvas(c))
+}
+
+// batch runs the recipe against each file, saved to the out path of the same
+// index, with the provided number of jobs, providing a result for each file in
+// order.
+func batch(o *Options, c context.Context, r *core.Recipe, files, outs []string, jobs int) []batchResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	ret := make([]batchResult, len(files))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				in, p := files[i], outs[i]
+				ret[i] = batchResult{in, p, batchFile(o, c, r, in, p)}
+			}
+		}()
+	}
+	for i := range files {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return ret
+}
+
+func writeBatch(msg *bytes.Buffer, rs []batchResult) int {
+	var failed int
+	for _, r := range rs {
+		out := r.out
+		if out == "" {
+			out = r.in
+		}
+		switch r.err {
+		case nil:
+			msg.WriteString(fmt.Sprintf("ok\t%s -> %s\n", r.in, out))
+		default:
+			failed++
+			msg.WriteString(fmt.Sprintf("failed\t%s: %s\n", r.in, r.err))
+		}
+	}
+	msg.WriteString(fmt.Sprintf("%d processed, %d ok, %d failed\n", len(rs), len(rs)-failed, failed))
+	writeOnce(os.Stdout, msg)
+	return failed
+}
+
+func BatchCommand() flip.Command {
+	bo := &defaultBatchOptions
+	fs := flip.NewFlagSet("batch", flip.ContinueOnError)
+	fs = bFlags(fs, bo)
+
+	return flip.NewCommand(
+		"",
+		"batch",
+		"Run a core command or recipe against many images at once",
+		1,
+		false,
+		func(c context.Context, a []string) (context.Context, flip.ExitStatus) {
+			msg := new(bytes.Buffer)
+			r, err := batchRecipe(bo)
+			if err == nil {
+				err = r.Validate()
+			}
+			if err != nil {
+				return c, failure(msg, "batch recipe", err)
+			}
+			files, err := batchFiles(bo.in)
+			if err != nil {
+				return c, failure(msg, "batch files", err)
+			}
+			outs, err := batchOuts(bo, files)
+			if err != nil {
+				return c, failure(msg, "batch out", err)
+			}
+			if writeBatch(msg, batch(O, c, r, files, outs, bo.jobs)) > 0 {
+				return c, flip.ExitFailure
+			}
+			return c, flip.ExitSuccess
+		},
+		fs,
+	)
+}
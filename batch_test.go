@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/processor"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/geo"
+)
+
+func writeImages(t *testing.T, paths ...string) {
+	for _, p := range paths {
+		cv, err := canvas.New(canvas.SetColorModel("RGBA"), canvas.SetPath(p, ""), canvas.SetRect(8, 8))
+		if err != nil {
+			t.Fatalf("batch image error: %s", err)
+		}
+		if err = cv.Save(); err != nil {
+			t.Fatalf("batch image save error: %s", err)
+		}
+	}
+}
+
+func TestBatchOut(t *testing.T) {
+	for _, v := range []struct {
+		out, in, want string
+	}{
+		{"", "img/a.png", ""},
+		{"out", "img/a.png", "out/a.png"},
+		{"{dir}/{name}_thumb.{ext}", "img/a.png", "img/a_thumb.png"},
+		{"out/{name}.jpg", "img/a.b.png", "out/a.b.jpg"},
+		{"{name}", "a", "a"},
+	} {
+		if got := batchOut(v.out, v.in); got != v.want {
+			t.Errorf("batch out %q of %s: expected %q, got %q", v.out, v.in, v.want, got)
+		}
+	}
+}
+
+func TestBatchOuts(t *testing.T) {
+	for _, v := range []struct {
+		name    string
+		o       bOptions
+		files   []string
+		want    []string
+		wantErr error
+	}{
+		{"neither", bOptions{}, []string{"a.png"}, nil, batchOutError},
+		{"both", bOptions{out: "out", inPlace: true}, []string{"a.png"}, nil, batchPlaceError},
+		{"in place", bOptions{inPlace: true}, []string{"a.png", "b.png"}, []string{"", ""}, nil},
+		{"dir", bOptions{out: "out"}, []string{"a/x.png", "a/y.png"}, []string{"out/x.png", "out/y.png"}, nil},
+		{"other out", bOptions{out: "out"}, []string{"a/x.png", "b/x.png"}, nil, nil},
+		{"other in", bOptions{out: "{dir}/b.{ext}"}, []string{"a.png", "b.png"}, nil, nil},
+		{"own in", bOptions{out: "{dir}/{name}.{ext}"}, []string{"a.png", "b.png"}, []string{"./a.png", "./b.png"}, nil},
+	} {
+		got, err := batchOuts(&v.o, v.files)
+		switch {
+		case v.wantErr != nil:
+			if err != v.wantErr {
+				t.Errorf("%s: expected %v, got %v", v.name, v.wantErr, err)
+			}
+		case v.want == nil:
+			if err == nil {
+				t.Errorf("%s: expected a collision, got %v", v.name, got)
+			}
+		case err != nil:
+			t.Errorf("%s: %s", v.name, err)
+		case !reflect.DeepEqual(got, v.want):
+			t.Errorf("%s: expected %v, got %v", v.name, v.want, got)
+		}
+	}
+}
+
+func TestBatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-warhola-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.jpg")
+	writeImages(t, a, b)
+	ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("c"), 0644)
+	os.Mkdir(filepath.Join(dir, "sub.png"), 0755)
+
+	for _, v := range []struct {
+		name, in string
+		want     []string
+	}{
+		{"dir", dir, []string{a, b}},
+		{"glob", filepath.Join(dir, "*.png"), []string{a}},
+		{"dedup", dir + "," + filepath.Join(dir, "*"), []string{a, b}},
+		{"order", b + "," + a, []string{a, b}},
+		{"no match", filepath.Join(dir, "*.gif"), nil},
+		{"none", "", nil},
+	} {
+		got, err := batchFiles(v.in)
+		switch {
+		case v.want == nil:
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", v.name, got)
+			}
+		case err != nil:
+			t.Errorf("%s: %s", v.name, err)
+		case !reflect.DeepEqual(got, v.want):
+			t.Errorf("%s: expected %v, got %v", v.name, v.want, got)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-warhola-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	names := []string{"a", "b", "c"}
+	var in []string
+	for _, n := range names {
+		in = append(in, filepath.Join(dir, n+".png"))
+	}
+	writeImages(t, in...)
+
+	bo := &bOptions{in: dir, out: filepath.Join(dir, "out", "{name}_half.{ext}"), command: "resize -geometry 50%"}
+	r, err := batchRecipe(bo)
+	if err != nil {
+		t.Fatalf("batch recipe error: %s", err)
+	}
+	files, err := batchFiles(bo.in)
+	if err != nil {
+		t.Fatalf("batch files error: %s", err)
+	}
+	outs, err := batchOuts(bo, files)
+	if err != nil {
+		t.Fatalf("batch outs error: %s", err)
+	}
+	o := defaultOptions()
+	if o.proc, err = processor.New(processor.SetLogger(o.Logger)); err != nil {
+		t.Fatalf("batch processor error: %s", err)
+	}
+	o.G = geo.New("")
+	for i, res := range batch(o, context.Background(), r, files, outs, 2) {
+		want := filepath.Join(dir, "out", names[i]+"_half.png")
+		if res.err != nil || res.in != in[i] || res.out != want {
+			t.Errorf("expected %s -> %s, got %+v", in[i], want, res)
+			continue
+		}
+		cv, err := canvas.New(canvas.SetColorModel("RGBA"), canvas.SetPath(want, ""))
+		if err != nil {
+			t.Fatalf("batch out open error: %s", err)
+		}
+		if cv.Bounds() != image.Rect(0, 0, 4, 4) {
+			t.Errorf("expected %s resized to 4x4, got %v", want, cv.Bounds())
+		}
+	}
+}
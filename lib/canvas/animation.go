@@ -0,0 +1,147 @@
+package canvas
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// An interface for canvases holding more than one frame, i.e. an animated gif.
+type Framer interface {
+	Frames() int
+	EachFrame(func(int, Canvas) error) error
+}
+
+type frame struct {
+	*pxl
+	delay    int
+	disposal byte
+}
+
+type animation struct {
+	frames []*frame
+	loop   int
+}
+
+func singleFrame(p *pxl) *animation {
+	return &animation{
+		frames: []*frame{&frame{pxl: p}},
+	}
+}
+
+func (a *animation) clone(fn func(*pxl) *pxl) *animation {
+	na := &animation{loop: a.loop}
+	for _, f := range a.frames {
+		na.frames = append(na.frames, &frame{fn(f.pxl), f.delay, f.disposal})
+	}
+	return na
+}
+
+// The number of frames held by the canvas, 1 for any non animated canvas.
+func (c *canvas) Frames() int {
+	if c.anim == nil {
+		return 1
+	}
+	return len(c.anim.frames)
+}
+
+// Calls the provided function with a Canvas for each frame held by the canvas,
+// in order. Changes made to the provided Canvas are kept for that frame.
+func (c *canvas) EachFrame(fn func(int, Canvas) error) error {
+	if c.anim == nil {
+		return fn(0, c)
+	}
+	defer func() { c.pxl = c.anim.frames[0].pxl }()
+	for i, f := range c.anim.frames {
+		fc := &canvas{
+			Logger:        c.Logger,
+			Configuration: c.Configuration,
+			identity:      c.identity,
+			pxl:           f.pxl,
+			encoder:       c.encoder,
+			sel:           c.sel,
+		}
+		if err := fn(i, fc); err != nil {
+			return err
+		}
+		f.pxl = fc.pxl
+	}
+	return nil
+}
+
+var gifMagic = [][]byte{[]byte("GIF87a"), []byte("GIF89a")}
+
+func isGif(r *bufio.Reader) bool {
+	b, err := r.Peek(6)
+	if err != nil {
+		return false
+	}
+	for _, m := range gifMagic {
+		if bytes.Equal(b, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeAnimation renders every frame of the decoded gif onto a full size
+// frame, honoring the disposal of each preceding frame. The first frame is
+// rendered to the provided pxl.
+func decodeAnimation(g *gif.GIF, p *pxl) (*animation, error) {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, i := range g.Image {
+			bounds = bounds.Union(i.Bounds())
+		}
+	}
+	cur := image.NewRGBA(bounds)
+	a := &animation{loop: g.LoopCount}
+	for i, src := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var prev *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			prev = image.NewRGBA(bounds)
+			copy(prev.Pix, cur.Pix)
+		}
+
+		draw.Draw(cur, src.Bounds(), src, src.Bounds().Min, draw.Over)
+
+		fp := p
+		if i > 0 {
+			fp = &pxl{m: p.m, pix: make([]uint8, 0)}
+			fp.measure = newMeasure(&fp.rect, p.measure.pp, p.measure.ppu)
+		}
+		if _, err := existingTo(cur, fp); err != nil {
+			return nil, err
+		}
+		var delay int
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+		}
+		a.frames = append(a.frames, &frame{fp, delay, disposal})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(cur, src.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			cur = prev
+		}
+	}
+	return a, nil
+}
+
+func encodeGif(w io.Writer, a *animation) error {
+	g := &gif.GIF{LoopCount: a.loop}
+	for _, f := range a.frames {
+		g.Image = append(g.Image, quantize(f.pxl, 256))
+		g.Delay = append(g.Delay, f.delay)
+		g.Disposal = append(g.Disposal, f.disposal)
+	}
+	return gif.EncodeAll(w, g)
+}
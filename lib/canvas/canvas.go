@@ -1,6 +1,7 @@
 package canvas
 
 import (
+	"image"
 	"image/color"
 
 	"github.com/Laughs-In-Flowers/log"
@@ -12,6 +13,7 @@ func New(cnf ...Config) (Canvas, error) {
 	c := &canvas{
 		identity: newIdentity(),
 		pxl:      newPxl(),
+		encoder:  defaultEncoder(),
 	}
 	cc := newConfiguration(c, cnf...)
 	err := cc.Configure()
@@ -21,6 +23,23 @@ func New(cnf ...Config) (Canvas, error) {
 	return c, nil
 }
 
+// Provides a new canvas of a copy of the provided image, held in memory only
+// until saved to another path, e.g. for testing commands without files.
+func FromImage(i image.Image, cnf ...Config) (Canvas, error) {
+	b := i.Bounds()
+	cv, err := New(append([]Config{
+		SetColorModel(WorkingColorModelString),
+		SetMemory(),
+		SetRect(b.Dx(), b.Dy()),
+	}, cnf...)...)
+	if err != nil {
+		return nil, err
+	}
+	c := cv.(*canvas)
+	c.pxl, err = replace(c.pxl, i)
+	return c, err
+}
+
 // The primary interface for all image manipulation needs.
 type Canvas interface {
 	log.Logger
@@ -30,6 +49,10 @@ type Canvas interface {
 	Saver
 	Cloner
 	Operator
+	ColorStats
+	Framer
+	Historian
+	Selector
 }
 
 type canvas struct {
@@ -37,6 +60,13 @@ type canvas struct {
 	Configuration
 	*identity
 	*pxl
+	*encoder
+	anim   *animation
+	meta   *metadata
+	orient bool
+	hist   *history
+	sel    Selection
+	set    *setting
 }
 
 // An interface for denoting a non operational Canvas.
@@ -65,13 +95,22 @@ type Saver interface {
 	SaveTo(string) error
 }
 
-var SaveNoopError = xrr.Xrror("cannot save a non operational canvas")
+var (
+	SaveNoopError   = xrr.Xrror("cannot save a non operational canvas")
+	SaveMemoryError = xrr.Xrror("cannot save a canvas held in memory, set a path to save it")
+)
 
 // Saves the canvas according to its current status.
 func (c *canvas) Save() error {
+	if c.memory {
+		return SaveMemoryError
+	}
 	if !c.Noop() {
 		c.Printf("canvas %s saving...", c.path)
-		return save(c.path, c.fileType, c.pxl)
+		if c.anim != nil && c.fileType == GIF {
+			return saveAnimation(c.path, c.anim, c.encoder)
+		}
+		return save(c.path, c.fileType, c.pxl, c.encoder)
 	}
 	return SaveNoopError
 }
@@ -106,17 +145,56 @@ func cloneTo(c *canvas, m color.Model) *canvas {
 		Configuration: c.Configuration,
 		identity:      c.identity.clone(),
 		pxl:           c.pxl.clone(m),
+		encoder:       c.encoder.clone(),
+		meta:          c.meta,
+		hist:          c.hist.clone(),
+		sel:           c.sel,
+	}
+	if c.anim != nil {
+		nc.anim = c.anim.clone(func(p *pxl) *pxl { return p.clone(m) })
+		nc.pxl = nc.anim.frames[0].pxl
 	}
 	return nc
 }
 
 type canvasMutate func() (*pxl, error)
 
-func (c *canvas) mutate(fn canvasMutate) error {
+// mutate replaces the canvas pxl with the result of the provided function, for
+// an animated canvas the function is called once with each frame as the pxl.
+// Where the canvas has a Selection the result is restricted to it, once, so an
+// operation of several passes is made within a single mutate, and where the
+// canvas keeps a history the result is recorded as produced by op.
+func (c *canvas) mutate(op string, fn canvasMutate) error {
+	var prior *state
+	if c.hist.enabled() {
+		prior = c.snapshot("original")
+	}
+	if err := c.apply(fn); err != nil {
+		return err
+	}
+	if prior != nil {
+		c.record(prior, op)
+	}
+	return nil
+}
+
+func (c *canvas) apply(fn canvasMutate) error {
+	if c.anim != nil {
+		defer func() { c.pxl = c.anim.frames[0].pxl }()
+		for _, f := range c.anim.frames {
+			c.pxl = f.pxl
+			np, err := fn()
+			if err != nil {
+				return err
+			}
+			f.pxl = c.masked(f.pxl, np)
+		}
+		return nil
+	}
 	np, err := fn()
 	if err != nil {
 		return err
 	}
-	c.pxl = np
+	c.pxl = c.masked(c.pxl, np)
 	return nil
 }
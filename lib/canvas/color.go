@@ -3,10 +3,14 @@ package canvas
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 	"strings"
+	"sync"
 
 	"github.com/Laughs-In-Flowers/warhola/lib/util/mth"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/prl"
+	"github.com/Laughs-In-Flowers/xrr"
 )
 
 type ColorModel int
@@ -430,66 +434,90 @@ func (c channel) String() string {
 	return "no channel"
 }
 
-//channel
-func (c *canvas) Channel(ch string) (*image.Gray, error) {
-	/*
-	   	//if c < 0 || 3 < c {
-	   	//	panic(fmt.Sprintf("channel index '%v' out of bounds. Red: 0, Green: 1, Blue: 2, Alpha: 3", c))
-	   	//}
-
-	   	src := clone.AsRGBA(img)
-	   	bounds := src.Bounds()
-	   	srcW, srcH := bounds.Dx(), bounds.Dy()
+var NoChannelError = xrr.Xrror("'%s' is not a channel [red|green|blue|alpha]").Out
 
-	   	if bounds.Empty() {
-	   		return &image.Gray{}
-	   	}
+// Channel returns a grayscale image of the named channel (red, green, blue, or
+// alpha) of the canvas.
+func (c *canvas) Channel(ch string) (*image.Gray, error) {
+	cc := stringToChannel(ch)
+	if cc == cNo {
+		return nil, NoChannelError(ch)
+	}
+	return channelOf(c.pxl, cc), nil
+}
 
-	   	dst := image.NewGray(bounds)
+type Channeler interface {
+	ToChannel(string) error
+}
 
-	   	parallel.Line(srcH, func(start, end int) {
-	   		for y := start; y < end; y++ {
-	   			for x := 0; x < srcW; x++ {
-	   				srcPos := y*src.Stride + x*4
-	   				dstPos := y*dst.Stride + x
+// ToChannel replaces the canvas with a grayscale image of the named channel
+// (red, green, blue, or alpha) of the canvas.
+func (c *canvas) ToChannel(ch string) error {
+	cc := stringToChannel(ch)
+	if cc == cNo {
+		return NoChannelError(ch)
+	}
+	return c.mutate("channel "+cc.String(), func() (*pxl, error) {
+		np := c.pxl.clone(c.pxl.ColorModel())
+		draw.Draw(np, np.rect, channelOf(c.pxl, cc), image.ZP, draw.Src)
+		return np, nil
+	})
+}
 
-	   				dst.Pix[dstPos] = src.Pix[srcPos+int(c)]
-	   			}
-	   		}
-	   	})
+func channelOf(p *pxl, c channel) *image.Gray {
+	srcP := p.clone(WorkingColorModelFn)
+	b := srcP.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	if b.Empty() {
+		return dst
+	}
+	idx := int(c) - 1
+	prl.Run(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < w; x++ {
+				srcPos := y*srcP.str + x*4
+				dstPos := y*dst.Stride + x
+				dst.Pix[dstPos] = srcP.pix[srcPos+idx]
+			}
+		}
+	})
+	return dst
+}
 
-	   return dst
-	*/
-	return nil, nil
+// Rank returns the perceived luminance of the provided color in the range of
+// 0 to 255.
+func Rank(c color.RGBA) float64 {
+	return float64(c.R)*0.299 + float64(c.G)*0.587 + float64(c.B)*0.114
 }
 
-//threshold
+// Threshold returns a grayscale image where every pixel with a luminance rank
+// greater than or equal to the provided level is white and all others black.
 func (c *canvas) Threshold(l uint8) (*image.Gray, error) {
-	/*
-		src := clone.AsRGBA(img)
-			bounds := src.Bounds()
-
-			dst := image.NewGray(bounds)
-
-			for y := 0; y < bounds.Dy(); y++ {
-				for x := 0; x < bounds.Dx(); x++ {
-					srcPos := y*src.Stride + x*4
-					dstPos := y*dst.Stride + x
-
-					c := src.Pix[srcPos : srcPos+4]
-					r := util.Rank(color.RGBA{c[0], c[1], c[2], c[3]})
+	return threshold(c.pxl, l), nil
+}
 
-					if uint8(r) >= level {
-						dst.Pix[dstPos] = 0xFF
-					} else {
-						dst.Pix[dstPos] = 0x00
-					}
+func threshold(p *pxl, l uint8) *image.Gray {
+	srcP := p.clone(WorkingColorModelFn)
+	b := srcP.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	prl.Run(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < w; x++ {
+				srcPos := y*srcP.str + x*4
+				dstPos := y*dst.Stride + x
+				c := srcP.pix[srcPos : srcPos+4]
+				r := Rank(color.RGBA{c[0], c[1], c[2], c[3]})
+				if uint8(r) >= l {
+					dst.Pix[dstPos] = 0xFF
+				} else {
+					dst.Pix[dstPos] = 0x00
 				}
 			}
-
-		return dst
-	*/
-	return nil, nil
+		}
+	})
+	return dst
 }
 
 type Histogram struct {
@@ -527,45 +555,46 @@ func (h *Histogram) Min() int {
 // Cumulative returns a new Histogram in which each bin is the cumulative
 // value of its previous bins
 func (h *Histogram) Cumulative() *Histogram {
-	/*
-		binCount := len(h.Bins)
-		out := Histogram{make([]int, binCount)}
+	binCount := len(h.Bins)
+	out := Histogram{make([]int, binCount)}
 
-		if binCount > 0 {
-			out.Bins[0] = h.Bins[0]
-		}
+	if binCount > 0 {
+		out.Bins[0] = h.Bins[0]
+	}
 
-		for i := 1; i < binCount; i++ {
-			out.Bins[i] = out.Bins[i-1] + h.Bins[i]
-		}
+	for i := 1; i < binCount; i++ {
+		out.Bins[i] = out.Bins[i-1] + h.Bins[i]
+	}
 
-		return &out
-	*/
-	return nil
+	return &out
+}
+
+func binHeight(v, max, h int) int {
+	if max == 0 {
+		max = 1
+	}
+	return int((int64(v) * int64(h)) / int64(max))
 }
 
 // Image returns a grayscale image representation of the Histogram.
 // The width and height of the image will be equivalent to the number of Bins in the Histogram.
 func (h *Histogram) Image() *image.Gray {
-	/*
-		dstW, dstH := len(h.Bins), len(h.Bins)
-		dst := image.NewGray(image.Rect(0, 0, dstW, dstH))
+	dstW, dstH := len(h.Bins), len(h.Bins)
+	dst := image.NewGray(image.Rect(0, 0, dstW, dstH))
 
-		max := h.Max()
-		if max == 0 {
-			max = 1
-		}
+	max := h.Max()
 
-		for x := 0; x < dstW; x++ {
-			value := ((int(h.Bins[x]) << 16 / max) * dstH) >> 16
+	prl.Run(dstW, func(start, end int) {
+		for x := start; x < end; x++ {
+			value := binHeight(h.Bins[x], max, dstH)
 			// Fill from the bottom up
 			for y := dstH - 1; y > dstH-value-1; y-- {
 				dst.Pix[y*dst.Stride+x] = 0xFF
 			}
 		}
-		return dst
-	*/
-	return nil
+	})
+
+	return dst
 }
 
 type RGBAHistogram struct {
@@ -575,63 +604,73 @@ type RGBAHistogram struct {
 	A Histogram
 }
 
+func newRGBAHistogram(binCount int) *RGBAHistogram {
+	return &RGBAHistogram{
+		R: Histogram{make([]int, binCount)},
+		G: Histogram{make([]int, binCount)},
+		B: Histogram{make([]int, binCount)},
+		A: Histogram{make([]int, binCount)},
+	}
+}
+
 // NewRGBAHistogram constructs a RGBAHistogram out of the provided image.
 // A sub-histogram is created per RGBA channel with 256 bins each.
 func NewRGBAHistogram(img image.Image) *RGBAHistogram {
-	/*
-		src := clone.AsRGBA(img)
-
-		binCount := 256
-		r := Histogram{make([]int, binCount)}
-		g := Histogram{make([]int, binCount)}
-		b := Histogram{make([]int, binCount)}
-		a := Histogram{make([]int, binCount)}
-
-		for y := 0; y < src.Bounds().Dy(); y++ {
-			for x := 0; x < src.Bounds().Dx(); x++ {
-				pos := y*src.Stride + x*4
-				r.Bins[src.Pix[pos+0]]++
-				g.Bins[src.Pix[pos+1]]++
-				b.Bins[src.Pix[pos+2]]++
-				a.Bins[src.Pix[pos+3]]++
+	var p *pxl
+	switch i := img.(type) {
+	case *pxl:
+		p = i
+	default:
+		b := img.Bounds()
+		rgba := WorkingColorModelNew(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+		p = scratch(newPxl(), WorkingColorModelFn, 0, 0)
+		existingTo(rgba, p)
+	}
+	return histogram(p)
+}
+
+func histogram(p *pxl) *RGBAHistogram {
+	srcP := p.clone(WorkingColorModelFn)
+	b := srcP.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	ret := newRGBAHistogram(256)
+	var mu sync.Mutex
+
+	prl.Run(h, func(start, end int) {
+		part := newRGBAHistogram(256)
+		for y := start; y < end; y++ {
+			for x := 0; x < w; x++ {
+				pos := y*srcP.str + x*4
+				part.R.Bins[srcP.pix[pos+0]]++
+				part.G.Bins[srcP.pix[pos+1]]++
+				part.B.Bins[srcP.pix[pos+2]]++
+				part.A.Bins[srcP.pix[pos+3]]++
 			}
 		}
+		mu.Lock()
+		for i := 0; i < 256; i++ {
+			ret.R.Bins[i] += part.R.Bins[i]
+			ret.G.Bins[i] += part.G.Bins[i]
+			ret.B.Bins[i] += part.B.Bins[i]
+			ret.A.Bins[i] += part.A.Bins[i]
+		}
+		mu.Unlock()
+	})
 
-		return &RGBAHistogram{R: r, G: g, B: b, A: a}
-	*/
-	return nil
+	return ret
 }
 
 // Cumulative returns a new RGBAHistogram in which each bin is the cumulative
 // value of its previous bins per channel.
 func (h *RGBAHistogram) Cumulative() *RGBAHistogram {
-	/*
-		binCount := len(h.R.Bins)
-
-		r := Histogram{make([]int, binCount)}
-		g := Histogram{make([]int, binCount)}
-		b := Histogram{make([]int, binCount)}
-		a := Histogram{make([]int, binCount)}
-
-		out := RGBAHistogram{R: r, G: g, B: b, A: a}
-
-		if binCount > 0 {
-			out.R.Bins[0] = h.R.Bins[0]
-			out.G.Bins[0] = h.G.Bins[0]
-			out.B.Bins[0] = h.B.Bins[0]
-			out.A.Bins[0] = h.A.Bins[0]
-		}
-
-		for i := 1; i < binCount; i++ {
-			out.R.Bins[i] = out.R.Bins[i-1] + h.R.Bins[i]
-			out.G.Bins[i] = out.G.Bins[i-1] + h.G.Bins[i]
-			out.B.Bins[i] = out.B.Bins[i-1] + h.B.Bins[i]
-			out.A.Bins[i] = out.A.Bins[i-1] + h.A.Bins[i]
-		}
-
-		return &out
-	*/
-	return nil
+	return &RGBAHistogram{
+		R: *h.R.Cumulative(),
+		G: *h.G.Cumulative(),
+		B: *h.B.Cumulative(),
+		A: *h.A.Cumulative(),
+	}
 }
 
 // Image returns an RGBA image representation of the RGBAHistogram.
@@ -641,32 +680,21 @@ func (h *RGBAHistogram) Cumulative() *RGBAHistogram {
 // so that for example if the red channel is extracted from the image, it corresponds to the
 // red channel histogram.
 func (h *RGBAHistogram) Image() *image.RGBA {
-	/*
-		if len(h.R.Bins) != 256 || len(h.G.Bins) != 256 ||
-			len(h.B.Bins) != 256 || len(h.A.Bins) != 256 {
-			panic("RGBAHistogram bins length not equal to 256")
-		}
+	dstW, dstH := 256, 256
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
 
-		dstW, dstH := 256, 256
-		dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	if len(h.R.Bins) != dstW || len(h.G.Bins) != dstW ||
+		len(h.B.Bins) != dstW || len(h.A.Bins) != dstW {
+		return dst
+	}
 
-		maxR := h.R.Max()
-		if maxR == 0 {
-			maxR = 1
-		}
-		maxG := h.G.Max()
-		if maxG == 0 {
-			maxG = 1
-		}
-		maxB := h.B.Max()
-		if maxB == 0 {
-			maxB = 1
-		}
+	maxR, maxG, maxB := h.R.Max(), h.G.Max(), h.B.Max()
 
-		for x := 0; x < dstW; x++ {
-			binHeightR := ((int(h.R.Bins[x]) << 16 / maxR) * dstH) >> 16
-			binHeightG := ((int(h.G.Bins[x]) << 16 / maxG) * dstH) >> 16
-			binHeightB := ((int(h.B.Bins[x]) << 16 / maxB) * dstH) >> 16
+	prl.Run(dstW, func(start, end int) {
+		for x := start; x < end; x++ {
+			binHeightR := binHeight(h.R.Bins[x], maxR, dstH)
+			binHeightG := binHeight(h.G.Bins[x], maxG, dstH)
+			binHeightB := binHeight(h.B.Bins[x], maxB, dstH)
 			// Fill from the bottom up
 			for y := dstH - 1; y >= 0; y-- {
 				pos := y*dst.Stride + x*4
@@ -684,13 +712,12 @@ func (h *RGBAHistogram) Image() *image.RGBA {
 				dst.Pix[pos+3] = 0xFF
 			}
 		}
+	})
 
-		return dst
-	*/
-	return nil
+	return dst
 }
 
-//histogram
+// RGBAHistogram returns a RGBAHistogram of the canvas.
 func (c *canvas) RGBAHistogram() *RGBAHistogram {
-	return nil
+	return histogram(c.pxl)
 }
@@ -1 +1,72 @@
 package canvas
+
+import (
+	"image/color"
+	"testing"
+)
+
+func newStatsCanvas(t *testing.T) Canvas {
+	c, err := New(
+		SetColorModel("RGBA"),
+		SetPath("/tmp/test-warhola-stats.png", ""),
+		SetFileType("png"),
+		SetRect(16, 8),
+	)
+	if err != nil {
+		t.Fatalf("new stats canvas error: %s", err)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			c.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 32), 0xFF, 0xFF})
+		}
+	}
+	return c
+}
+
+func TestColorStats(t *testing.T) {
+	id := "ColorStats"
+	c := newStatsCanvas(t)
+
+	// Channel
+	g, err := c.Channel("red")
+	if err != nil {
+		failProbe(t, id, "Channel", "unexpected error %s", err)
+	}
+	if gr := g.GrayAt(3, 2).Y; gr != 48 {
+		failProbe(t, id, "Channel", commonExpect, 48, gr)
+	}
+	if _, err = c.Channel("purple"); err == nil {
+		failProbe(t, id, "Channel", "expected error for unknown channel")
+	}
+
+	// Threshold
+	th, _ := c.Threshold(128)
+	lo, hi := th.GrayAt(0, 0).Y, th.GrayAt(15, 7).Y
+	if lo != 0x00 || hi != 0xFF {
+		failProbe(t, id, "Threshold", commonExpect, "0, 255", []uint8{lo, hi})
+	}
+
+	// Histogram
+	h := c.RGBAHistogram()
+	if b := h.B.Bins[0xFF]; b != 16*8 {
+		failProbe(t, id, "RGBAHistogram", commonExpect, 16*8, b)
+	}
+	if r := h.R.Bins[32]; r != 8 {
+		failProbe(t, id, "RGBAHistogram", commonExpect, 8, r)
+	}
+
+	// Cumulative
+	cu := h.Cumulative()
+	if last := cu.R.Bins[255]; last != 16*8 {
+		failProbe(t, id, "Cumulative", commonExpect, 16*8, last)
+	}
+
+	// Image
+	hi2 := h.Image()
+	if b := hi2.Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+		failProbe(t, id, "Image", commonExpect, "256x256", b)
+	}
+	if px := hi2.RGBAAt(0xFF, 255); px.B != 0xFF || px.R != 0 {
+		failProbe(t, id, "Image", commonExpect, "full blue bin", px)
+	}
+}
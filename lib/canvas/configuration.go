@@ -68,7 +68,7 @@ type configuration struct {
 func newConfiguration(v *canvas, conf ...Config) *configuration {
 	c := &configuration{
 		v:    v,
-		list: builtIns,
+		list: append(configList{}, builtIns...),
 	}
 	c.Add(conf...)
 	return c
@@ -95,7 +95,7 @@ func configure(v *canvas, conf ...Config) error {
 }
 
 func (c *configuration) Configure() error {
-	sort.Sort(c.list)
+	sort.Stable(c.list)
 
 	err := configure(c.v, c.list...)
 	if err == nil {
@@ -121,6 +121,8 @@ var builtIns = []Config{
 	config{1008, checkAction},
 	config{1009, action},
 	config{1010, checkPalette},
+	config{1011, checkEncoder},
+	config{1012, autoOrient},
 	config{9999, tearDown},
 }
 
@@ -144,11 +146,19 @@ func (n *note) addUn(msg string, items ...interface{}) {
 	n.has = append(n.has, act)
 }
 
-var expected, results *note
+// setting holds the state of a canvas while it is configured, kept with the
+// canvas so that any number of canvases may be configured at once.
+type setting struct {
+	expected, results *note
+	inPath, outPath   string
+}
 
 func setUp(c *canvas) error {
-	expected = newNote("canvas expected")
-	results = newNote("canvas actual")
+	c.set = &setting{
+		newNote("canvas expected"),
+		newNote("canvas actual"),
+		PATHNOOP, PATHNOOP,
+	}
 	return nil
 }
 
@@ -177,22 +187,17 @@ func SetColorModel(m string) Config {
 }
 
 func checkColorModel(c *canvas) error {
-	expected.add("color model is %s", c.pxl.m)
+	c.set.expected.add("color model is %s", c.pxl.m)
 	return nil
 }
 
-var (
-	inPath  string = PATHNOOP
-	outPath string = PATHNOOP
-)
-
 func setPath(c *canvas, in, out string) {
 	if in != "" {
-		inPath = in
+		c.set.inPath = in
 	}
 	c.path = in
 	if out != "" {
-		outPath = out
+		c.set.outPath = out
 	}
 }
 
@@ -204,10 +209,21 @@ func SetPath(in, out string) Config {
 		})
 }
 
+// Set the canvas as held only in memory, never opened and not saved until it is
+// given a path.
+func SetMemory() Config {
+	return NewConfig(3,
+		func(c *canvas) error {
+			setPath(c, "", "")
+			c.memory = true
+			return nil
+		})
+}
+
 func checkPath(c *canvas) error {
-	expected.add("in path is %s", c.path)
-	if outPath != PATHNOOP {
-		expected.add("out path is %s", outPath)
+	c.set.expected.add("in path is %s", c.path)
+	if c.set.outPath != PATHNOOP {
+		c.set.expected.add("out path is %s", c.set.outPath)
 	}
 	return nil
 }
@@ -221,7 +237,7 @@ func SetFileType(k string) Config {
 }
 
 func checkFileType(c *canvas) error {
-	expected.add("filetype is %s", c.fileType)
+	c.set.expected.add("filetype is %s", c.fileType)
 	return nil
 }
 
@@ -234,7 +250,7 @@ func SetRect(x, y int) Config {
 }
 
 func checkRect(c *canvas) error {
-	expected.add("rectangle dimensions are min %v max %v", c.rect.Min, c.rect.Max)
+	c.set.expected.add("rectangle dimensions are min %v max %v", c.rect.Min, c.rect.Max)
 	return nil
 }
 
@@ -247,8 +263,8 @@ func SetMeasure(pp float64, ppu string) Config {
 }
 
 func checkMeasure(c *canvas) error {
-	expected.addUn("canvas measure imperial: %F points per inch", c.ppi)
-	expected.addUn("canvas measure metric: %F points per cm", c.ppc)
+	c.set.expected.addUn("canvas measure imperial: %F points per inch", c.ppi)
+	c.set.expected.addUn("canvas measure metric: %F points per cm", c.ppc)
 	return nil
 }
 
@@ -257,6 +273,10 @@ func newAction(c *canvas) error {
 	if c.path != PATHNOOP {
 		_, err := os.Stat(c.path)
 		switch {
+		case c.path == PATHSTDIO:
+			act = ACTIONOPEN
+		case c.memory:
+			act = ACTIONNEW
 		case os.IsNotExist(err):
 			act = ACTIONNEW
 		default:
@@ -273,48 +293,73 @@ func checkAction(c *canvas) error {
 	if !c.Noop() {
 		switch {
 		case c.pxl.m == COLORNOOP:
-			results.addUn("noop color is %s", COLORNOOP)
+			c.set.results.addUn("noop color is %s", COLORNOOP)
 			return noopError(COLORNOOP)
 		case c.path == PATHNOOP:
-			results.addUn("noop path is %s", PATHNOOP)
+			c.set.results.addUn("noop path is %s", PATHNOOP)
 			return noopError(PATHNOOP)
 		case c.fileType == FILETYPENOOP:
-			results.addUn("noop filetype is %s", FILETYPENOOP)
+			c.set.results.addUn("noop filetype is %s", FILETYPENOOP)
 			return noopError(FILETYPENOOP)
 		case c.action == ACTIONNOOP:
-			results.add("noop action is %s", ACTIONNOOP)
+			c.set.results.add("noop action is %s", ACTIONNOOP)
 			return noopError(ACTIONNOOP)
 		}
 	}
-	expected.add("action: %s, %s, %s, %s", c.action, c.pxl.m, c.path, c.fileType)
+	c.set.expected.add("action: %s, %s, %s, %s", c.action, c.pxl.m, c.path, c.fileType)
 	return nil
 }
 
+// The FileType of the canvas is, in order of precedence: the extension of the
+// out path, the FileType set in configuration, the content of an opened file,
+// the extension of the in path of a new file, or png.
 func action(c *canvas) error {
 	var err error
 	var nk FileType
 	var cm ColorModel
+	set := c.fileType
 	switch c.action {
 	case ACTIONNEW:
 		err = newTo(c.pxl)
-		nk, cm = c.fileType, c.m
+		nk, cm = set, c.m
+		if nk == FILETYPENOOP {
+			nk = pathFileType(c.path)
+		}
+		if nk == FILETYPENOOP {
+			nk = PNG
+		}
 	case ACTIONOPEN:
-		nk, cm, err = openTo(c.path, c.pxl)
-		c.fileType = nk
+		var d *decoded
+		if d, err = openFramesTo(c.path, c.pxl); d != nil {
+			nk, cm, c.anim, c.meta = d.t, d.cm, d.anim, d.meta
+		}
+		if c.keepMeta {
+			c.encoder.meta = c.meta
+		}
 	default:
 		err = noopError(ACTIONNOOP)
 	}
-	if outPath != PATHNOOP {
-		c.SetPath(outPath)
+	c.in = c.path
+	if c.set.outPath != PATHNOOP {
+		c.SetPath(c.set.outPath)
 	}
+	if err == nil {
+		switch {
+		case pathFileType(c.path) != FILETYPENOOP:
+			nk = pathFileType(c.path)
+		case set != FILETYPENOOP:
+			nk = set
+		}
+	}
+	c.fileType = nk
 	if err != nil {
 		c.Printf("unable to perform action: %s", c.action)
 	}
-	results.add("color model is %s", cm)
-	results.add("path is %s", c.path)
-	results.add("filetype is %s", nk)
-	results.add("rectangle dimensions are min %v max %v", c.rect.Min, c.rect.Max)
-	results.add("action:\t%s\t%s\tin:%s\tout:%s\t%s", c.action, cm, inPath, outPath, nk)
+	c.set.results.add("color model is %s", cm)
+	c.set.results.add("path is %s", c.path)
+	c.set.results.add("filetype is %s", nk)
+	c.set.results.add("rectangle dimensions are min %v max %v", c.rect.Min, c.rect.Max)
+	c.set.results.add("action:\t%s\t%s\tin:%s\tout:%s\t%s", c.action, cm, c.set.inPath, c.set.outPath, nk)
 	return err
 }
 
@@ -324,7 +369,7 @@ func setPaletteFn(c *canvas, fn PaletteFunc) {
 
 func checkPalette(c *canvas) error {
 	if c.pxl.paletteFn == nil {
-		expected.addUn("canvas palette func is default")
+		c.set.expected.addUn("canvas palette func is default")
 	}
 	return nil
 }
@@ -333,18 +378,102 @@ func SetPaletteFn(fn PaletteFunc) Config {
 	return NewConfig(5,
 		func(c *canvas) error {
 			setPaletteFn(c, fn)
-			expected.addUn("canvas set custom palette func")
+			c.set.expected.addUn("canvas set custom palette func")
+			return nil
+		})
+}
+
+// Set the options used when encoding the canvas: jpeg quality (1-100), png
+// compression [default|none|speed|best], tiff compression [none|deflate|lzw] and
+// whether a tiff predictor is used.
+func SetEncodeOptions(quality int, pngCompression, tiffCompression string, tiffPredictor bool) Config {
+	return NewConfig(7,
+		func(c *canvas) error {
+			if quality < 1 || quality > 100 {
+				return jpgQualityError(quality)
+			}
+			pc, err := stringToPngCompression(pngCompression)
+			if err != nil {
+				return err
+			}
+			tc, err := stringToTiffCompression(tiffCompression)
+			if err != nil {
+				return err
+			}
+			c.jpgQuality, c.pngCompression = quality, pc
+			c.tiffCompression, c.tiffPredictor = tc, tiffPredictor
+			return nil
+		})
+}
+
+func checkEncoder(c *canvas) error {
+	switch c.fileType {
+	case JPG:
+		c.set.expected.addUn("canvas jpeg quality %d", c.jpgQuality)
+	case PNG:
+		c.set.expected.addUn("canvas png compression %d", c.pngCompression)
+	case TIFF:
+		c.set.expected.addUn("canvas tiff compression %d, predictor %t", c.tiffCompression, c.tiffPredictor)
+	}
+	return nil
+}
+
+// Set whether exif and xmp metadata of an opened file is carried through to a
+// saved jpeg or tiff.
+func SetKeepMetadata(keep bool) Config {
+	return NewConfig(8,
+		func(c *canvas) error {
+			c.keepMeta = keep
 			return nil
 		})
 }
 
+// Set whether an existing file is kept as a .bak file when the canvas is saved
+// over it.
+func SetBackup(backup bool) Config {
+	return NewConfig(8,
+		func(c *canvas) error {
+			c.backup = backup
+			return nil
+		})
+}
+
+// Set the number of prior states of the canvas kept for Undo and Redo, where
+// 0 keeps no history.
+func SetHistory(limit int) Config {
+	return NewConfig(8,
+		func(c *canvas) error {
+			c.hist = newHistory(limit)
+			return nil
+		})
+}
+
+// Set whether an opened file is rotated and flipped to its exif orientation.
+func SetAutoOrient(auto bool) Config {
+	return NewConfig(8,
+		func(c *canvas) error {
+			c.orient = auto
+			return nil
+		})
+}
+
+func autoOrient(c *canvas) error {
+	if c.meta != nil {
+		c.set.results.addUn("canvas exif orientation %d", c.meta.orientation)
+		if c.orient {
+			return orient(c)
+		}
+	}
+	return nil
+}
+
 func tearDown(c *canvas) error {
-	for _, v := range expected.has {
+	for _, v := range c.set.expected.has {
 		c.Print(v)
 	}
-	for _, v := range results.has {
+	for _, v := range c.set.results.has {
 		c.Print(v)
 	}
-	expected, results = nil, nil
+	c.set = nil
 	return nil
 }
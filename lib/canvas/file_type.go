@@ -1,12 +1,14 @@
 package canvas
 
 import (
+	"bytes"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
-	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/Laughs-In-Flowers/xrr"
 	"golang.org/x/image/bmp"
@@ -22,6 +24,7 @@ const (
 	JPG
 	PNG
 	TIFF
+	GIF
 )
 
 //A variable containing a listing of available and fully functional FileType.
@@ -30,9 +33,20 @@ var AvailableFileType = []FileType{
 	JPG,
 	PNG,
 	TIFF,
+	GIF,
 }
 
 func stringToFileType(s string) FileType {
+	if t := builtInFileType(s); t != FILETYPENOOP {
+		return t
+	}
+	if r, ok := namedFileTypeCodec(s); ok {
+		return r.t
+	}
+	return FILETYPENOOP
+}
+
+func builtInFileType(s string) FileType {
 	switch strings.ToUpper(s) {
 	case "BMP":
 		return BMP
@@ -40,12 +54,25 @@ func stringToFileType(s string) FileType {
 		return JPG
 	case "PNG":
 		return PNG
-	case "TIFF":
+	case "TIFF", "TIF":
 		return TIFF
+	case "GIF":
+		return GIF
 	}
 	return FILETYPENOOP
 }
 
+// pathFileType provides the FileType of the extension of the provided path, or
+// FILETYPENOOP for a path without a recognized extension.
+func pathFileType(path string) FileType {
+	return stringToFileType(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// Whether the extension of the provided path is that of an available FileType.
+func IsFileTypePath(path string) bool {
+	return pathFileType(path) != FILETYPENOOP
+}
+
 // Provides a string of this FileType.
 func (t FileType) String() string {
 	switch t {
@@ -57,27 +84,212 @@ func (t FileType) String() string {
 		return "png"
 	case TIFF:
 		return "tiff"
+	case GIF:
+		return "gif"
+	}
+	if r, ok := fileTypeCodec(t); ok {
+		return r.Name
 	}
 	return "FileTypeNoop"
 }
 
+// A FileTypeCodec provides a FileType beyond those of canvas, e.g. from a
+// plugin. Name is the name of the type, used by SetFileType and in decoding;
+// Extensions are any further path extensions of the type. Decode is used for
+// files beginning with Magic, as with image.RegisterFormat, and may be nil for
+// a type that is only written, as Encode may be nil for one only read.
+type FileTypeCodec struct {
+	Name         string
+	Extensions   []string
+	Magic        string
+	Decode       func(io.Reader) (image.Image, error)
+	DecodeConfig func(io.Reader) (image.Config, error)
+	Encode       func(io.Writer, image.Image) error
+	t            FileType
+}
+
+var fileTypes = struct {
+	sync.RWMutex
+	has []*FileTypeCodec
+}{}
+
+var (
+	FileTypeExistsError = xrr.Xrror("filetype %s already exists").Out
+	FileTypeCodecError  = xrr.Xrror("filetype %s: %s").Out
+)
+
+// Provides the available FileType, of AvailableFileType and those registered.
+func AvailableFileTypes() []FileType {
+	fileTypes.RLock()
+	defer fileTypes.RUnlock()
+	ret := append([]FileType{}, AvailableFileType...)
+	for _, c := range fileTypes.has {
+		ret = append(ret, c.t)
+	}
+	return ret
+}
+
+// Registers the provided FileTypeCodec, providing its new FileType and any
+// error. The FileType is added to AvailableFileTypes.
+func RegisterFileType(c FileTypeCodec) (FileType, error) {
+	switch {
+	case c.Name == "":
+		return FILETYPENOOP, FileTypeCodecError("", "no name")
+	case c.Decode == nil && c.Encode == nil:
+		return FILETYPENOOP, FileTypeCodecError(c.Name, "no decoder or encoder")
+	case c.Decode != nil && c.Magic == "":
+		return FILETYPENOOP, FileTypeCodecError(c.Name, "a decoder needs magic")
+	}
+	fileTypes.Lock()
+	defer fileTypes.Unlock()
+	for _, n := range append([]string{c.Name}, c.Extensions...) {
+		if _, ok := namedCodec(n); ok || builtInFileType(n) != FILETYPENOOP {
+			return FILETYPENOOP, FileTypeExistsError(n)
+		}
+	}
+	c.t = GIF + FileType(len(fileTypes.has)+1)
+	fileTypes.has = append(fileTypes.has, &c)
+	if c.Decode != nil {
+		dc := c.DecodeConfig
+		if dc == nil {
+			dc = func(r io.Reader) (image.Config, error) {
+				i, err := c.Decode(r)
+				if err != nil {
+					return image.Config{}, err
+				}
+				return image.Config{ColorModel: i.ColorModel(), Width: i.Bounds().Dx(), Height: i.Bounds().Dy()}, nil
+			}
+		}
+		image.RegisterFormat(c.Name, c.Magic, c.Decode, dc)
+	}
+	return c.t, nil
+}
+
+// fileTypeCodec provides the registered FileTypeCodec of the FileType, and
+// whether one exists.
+func fileTypeCodec(t FileType) (*FileTypeCodec, bool) {
+	fileTypes.RLock()
+	defer fileTypes.RUnlock()
+	for _, c := range fileTypes.has {
+		if c.t == t {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// namedFileTypeCodec provides the registered FileTypeCodec of the name or
+// extension, and whether one exists.
+func namedFileTypeCodec(s string) (*FileTypeCodec, bool) {
+	fileTypes.RLock()
+	defer fileTypes.RUnlock()
+	return namedCodec(s)
+}
+
+// namedCodec is namedFileTypeCodec for a caller holding the fileTypes lock.
+func namedCodec(s string) (*FileTypeCodec, bool) {
+	for _, c := range fileTypes.has {
+		for _, n := range append([]string{c.Name}, c.Extensions...) {
+			if strings.EqualFold(n, s) {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
 var (
 	encodeFileTypeError       = xrr.Xrror("unable to encode: FileTypeNoop")
 	unrecognizedFileTypeError = xrr.Xrror("%s is not a recognized filetype").Out
 )
 
-func (t FileType) encode(f *os.File, p *pxl) error {
+func (t FileType) encode(f io.Writer, p *pxl, e *encoder) error {
+	var b bytes.Buffer
+	var err error
 	switch t {
 	case BMP:
-		return encodeBmp(f, p)
+		err = encodeBmp(&b, p)
 	case JPG:
-		return encodeJpg(f, p)
+		err = e.encodeJpg(&b, p)
 	case PNG:
-		return encodePng(f, p)
+		err = e.encodePng(&b, p)
 	case TIFF:
-		return encodeTiff(f, p)
+		err = e.encodeTiff(&b, p)
+	case GIF:
+		err = encodeGif(&b, singleFrame(p))
+	default:
+		if r, ok := fileTypeCodec(t); ok && r.Encode != nil {
+			err = r.Encode(&b, p)
+			break
+		}
+		err = encodeFileTypeError
+	}
+	if err != nil {
+		return err
+	}
+	out := writeResolution(t, b.Bytes(), p.measure)
+	_, err = f.Write(writeMetadata(t, out, p, e.meta))
+	return err
+}
+
+// encoder holds the per canvas options provided to the image encoders, and
+// used in writing the encoded file.
+type encoder struct {
+	jpgQuality      int
+	pngCompression  png.CompressionLevel
+	tiffCompression tiff.CompressionType
+	tiffPredictor   bool
+	keepMeta        bool
+	meta            *metadata
+	backup          bool
+}
+
+func defaultEncoder() *encoder {
+	return &encoder{
+		jpgQuality:      100,
+		pngCompression:  png.DefaultCompression,
+		tiffCompression: tiff.Uncompressed,
+		tiffPredictor:   false,
 	}
-	return encodeFileTypeError
+}
+
+func (e *encoder) clone() *encoder {
+	ne := *e
+	return &ne
+}
+
+var (
+	jpgQualityError      = xrr.Xrror("jpeg quality must be between 1 and 100, provided %d").Out
+	pngCompressionError  = xrr.Xrror("%s is not a recognized png compression [default|none|speed|best]").Out
+	tiffCompressionError = xrr.Xrror("%s is not a supported tiff compression [none|deflate|lzw]").Out
+)
+
+func stringToPngCompression(s string) (png.CompressionLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return png.DefaultCompression, nil
+	case "none", "no":
+		return png.NoCompression, nil
+	case "speed", "fast":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	}
+	return png.DefaultCompression, pngCompressionError(s)
+}
+
+// Tiff is written uncompressed, deflate or lzw compressed, any other
+// compression is an error at configuration rather than at save.
+func stringToTiffCompression(s string) (tiff.CompressionType, error) {
+	switch strings.ToLower(s) {
+	case "", "none", "uncompressed":
+		return tiff.Uncompressed, nil
+	case "deflate", "zip":
+		return tiff.Deflate, nil
+	case "lzw":
+		return tiff.LZW, nil
+	}
+	return tiff.Uncompressed, tiffCompressionError(s)
 }
 
 func encodeBmp(w io.Writer, i image.Image) error {
@@ -87,29 +299,27 @@ func encodeBmp(w io.Writer, i image.Image) error {
 	return nil
 }
 
-var jpgQuality int = 100
-
-func encodeJpg(w io.Writer, i image.Image) error {
-	if err := jpeg.Encode(w, i, &jpeg.Options{jpgQuality}); err != nil {
+func (e *encoder) encodeJpg(w io.Writer, i image.Image) error {
+	if err := jpeg.Encode(w, i, &jpeg.Options{Quality: e.jpgQuality}); err != nil {
 		return err
 	}
 	return nil
 }
 
-func encodePng(w io.Writer, i image.Image) error {
-	if err := png.Encode(w, i); err != nil {
+func (e *encoder) encodePng(w io.Writer, i image.Image) error {
+	pe := &png.Encoder{CompressionLevel: e.pngCompression}
+	if err := pe.Encode(w, i); err != nil {
 		return err
 	}
 	return nil
 }
 
-var (
-	tiffCompression tiff.CompressionType = tiff.Uncompressed
-	tiffPredictor   bool                 = false
-)
-
-func encodeTiff(w io.Writer, i image.Image) error {
-	if err := tiff.Encode(w, i, &tiff.Options{tiffCompression, tiffPredictor}); err != nil {
+func (e *encoder) encodeTiff(w io.Writer, i image.Image) error {
+	if e.tiffCompression == tiff.LZW {
+		return encodeTiffLZW(w, i, e.tiffPredictor)
+	}
+	o := &tiff.Options{Compression: e.tiffCompression, Predictor: e.tiffPredictor}
+	if err := tiff.Encode(w, i, o); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,268 @@
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/tiff/lzw"
+)
+
+func newEncodeCanvas(t *testing.T, path, fileType string, cnf ...Config) Canvas {
+	cnf = append([]Config{
+		SetColorModel("RGBA"),
+		SetPath(path, ""),
+		SetFileType(fileType),
+		SetRect(64, 64),
+	}, cnf...)
+	c, err := New(cnf...)
+	if err != nil {
+		t.Fatalf("new encode canvas error: %s", err)
+	}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c.Set(x, y, color.RGBA{uint8(x / 8 * 32), uint8(y / 8 * 32), uint8(x * 4), 0xFF})
+		}
+	}
+	return c
+}
+
+func savedSize(t *testing.T, c Canvas) int64 {
+	if err := c.Save(); err != nil {
+		t.Fatalf("encode canvas save error: %s", err)
+	}
+	fi, err := os.Stat(c.Path())
+	if err != nil {
+		t.Fatalf("encode canvas stat error: %s", err)
+	}
+	os.Remove(c.Path())
+	return fi.Size()
+}
+
+func TestEncodeOptions(t *testing.T) {
+	id := "EncodeOptions"
+
+	hi := newEncodeCanvas(t, "/tmp/test-warhola-encode-hi.jpg", "jpg", SetEncodeOptions(100, "default", "none", false))
+	lo := newEncodeCanvas(t, "/tmp/test-warhola-encode-lo.jpg", "jpg", SetEncodeOptions(10, "default", "none", false))
+	if h, l := savedSize(t, hi), savedSize(t, lo); l >= h {
+		failProbe(t, id, "jpeg quality", "expected quality 10 (%d bytes) smaller than quality 100 (%d bytes)", l, h)
+	}
+
+	un := newEncodeCanvas(t, "/tmp/test-warhola-encode-un.tiff", "tiff")
+	df := newEncodeCanvas(t, "/tmp/test-warhola-encode-df.tiff", "tiff", SetEncodeOptions(100, "default", "deflate", false))
+	if u, d := savedSize(t, un), savedSize(t, df); d >= u {
+		failProbe(t, id, "tiff compression", "expected deflate (%d bytes) smaller than uncompressed (%d bytes)", d, u)
+	}
+
+	for _, p := range []bool{false, true} {
+		lz := newEncodeCanvas(t, "/tmp/test-warhola-encode-lzw.tiff", "tiff", SetEncodeOptions(100, "default", "lzw", p))
+		want := lz.Clone()
+		if u, l := savedSize(t, un), savedSize(t, lz); l >= u {
+			failProbe(t, id, "tiff lzw", "expected lzw (%d bytes) smaller than uncompressed (%d bytes), predictor %t", l, u, p)
+		}
+		lz.Save()
+		f, _ := os.Open(lz.Path())
+		got, err := tiff.Decode(f)
+		f.Close()
+		os.Remove(lz.Path())
+		if err != nil {
+			failProbe(t, id, "tiff lzw", "decode error %s, predictor %t", err, p)
+			continue
+		}
+		for _, pt := range []image.Point{{0, 0}, {13, 50}, {63, 63}} {
+			w, g := color.RGBAModel.Convert(want.At(pt.X, pt.Y)), color.RGBAModel.Convert(got.At(pt.X, pt.Y))
+			if w != g {
+				failProbe(t, id, "tiff lzw", "expected %v at %v, got %v, predictor %t", w, pt, g, p)
+			}
+		}
+	}
+
+	rnd := make([]byte, 1<<18)
+	for i := range rnd {
+		rnd[i] = byte(rr.Intn(256) / (1 + i%7))
+	}
+	for _, in := range [][]byte{nil, []byte("a"), bytes.Repeat([]byte("abc"), 1<<16), rnd} {
+		out, err := ioutil.ReadAll(lzw.NewReader(bytes.NewReader(tiffLZW(in)), lzw.MSB, 8))
+		if err != nil || !bytes.Equal(out, in) {
+			failProbe(t, id, "lzw", "expected %d bytes to round trip, got %d, %v", len(in), len(out), err)
+		}
+	}
+
+	for _, v := range []struct {
+		q      int
+		pc, tc string
+	}{
+		{0, "default", "none"},
+		{101, "default", "none"},
+		{90, "smallest", "none"},
+		{90, "default", "ccitt"},
+	} {
+		_, err := New(
+			SetColorModel("RGBA"),
+			SetPath("/tmp/test-warhola-encode-err.png", ""),
+			SetFileType("png"),
+			SetRect(1, 1),
+			SetEncodeOptions(v.q, v.pc, v.tc, false),
+		)
+		if err == nil {
+			failProbe(t, id, "SetEncodeOptions", "expected error for %d %s %s", v.q, v.pc, v.tc)
+		}
+	}
+}
+
+func TestGifReproducible(t *testing.T) {
+	c := newEncodeCanvas(t, "/tmp/test-warhola-reproducible.gif", "gif")
+	r := rand.New(rand.NewSource(1))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c.Set(x, y, color.RGBA{uint8(r.Intn(8) * 32), uint8(r.Intn(8) * 32), uint8(r.Intn(8) * 32), 0xFF})
+		}
+	}
+	p := c.(*canvas).pxl
+	var first []byte
+	for i := 0; i < 8; i++ {
+		var b bytes.Buffer
+		if err := encodeGif(&b, singleFrame(p)); err != nil {
+			t.Fatalf("gif encode error: %s", err)
+		}
+		if i == 0 {
+			first = b.Bytes()
+			continue
+		}
+		if !bytes.Equal(first, b.Bytes()) {
+			failProbe(t, "GifReproducible", "encode", "expected the same gif from the same image, encode %d differs", i)
+		}
+	}
+}
+
+func TestStdio(t *testing.T) {
+	id := "Stdio"
+	var in bytes.Buffer
+	if err := PNG.encode(&in, Scratch(color.RGBAModel, 3, 2), defaultEncoder()); err != nil {
+		t.Fatalf("stdio encode error: %s", err)
+	}
+	var out bytes.Buffer
+	stdin, stdout = &in, &out
+	defer func() { stdin, stdout = os.Stdin, os.Stdout }()
+
+	c, err := New(
+		SetColorModel("RGBA"),
+		SetPath(PATHSTDIO, ""),
+		SetFileType("jpg"),
+	)
+	if err != nil {
+		t.Fatalf("stdio canvas error: %s", err)
+	}
+	if err = c.Save(); err != nil {
+		t.Fatalf("stdio canvas save error: %s", err)
+	}
+	i, f, err := image.Decode(&out)
+	switch {
+	case err != nil:
+		failProbe(t, id, "stdout", "unable to decode standard output: %s", err)
+	case f != "jpeg":
+		failProbe(t, id, "stdout", commonExpect, "jpeg", f)
+	case i.Bounds().Dx() != 3 || i.Bounds().Dy() != 2:
+		failProbe(t, id, "stdout", commonExpect, "3x2", i.Bounds().Size())
+	}
+
+	// the out path extension takes precedence over the file type
+	path := "/tmp/test-warhola-stdio.tiff"
+	in.Reset()
+	PNG.encode(&in, Scratch(color.RGBAModel, 3, 2), defaultEncoder())
+	stdin = &in
+	if c, err = New(SetPath(PATHSTDIO, path), SetFileType("jpg")); err != nil {
+		t.Fatalf("stdio canvas error: %s", err)
+	}
+	if ft := c.FileType(); ft != "tiff" {
+		failProbe(t, id, "out path", commonExpect, "tiff", ft)
+	}
+}
+
+func TestRegisterFileType(t *testing.T) {
+	magic := "WHTST"
+	codec := FileTypeCodec{
+		Name:       "whtst",
+		Extensions: []string{"wht"},
+		Magic:      magic,
+		Decode: func(r io.Reader) (image.Image, error) {
+			b, err := ioutil.ReadAll(r)
+			if err != nil || len(b) < len(magic)+2 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			w, h := int(b[len(magic)]), int(b[len(magic)+1])
+			n := image.NewNRGBA(image.Rect(0, 0, w, h))
+			copy(n.Pix, b[len(magic)+2:])
+			return n, nil
+		},
+		Encode: func(w io.Writer, i image.Image) error {
+			b := i.Bounds()
+			n := image.NewNRGBA(b)
+			draw.Draw(n, b, i, b.Min, draw.Src)
+			w.Write([]byte(magic))
+			w.Write([]byte{byte(b.Dx()), byte(b.Dy())})
+			_, err := w.Write(n.Pix)
+			return err
+		},
+	}
+	ft, err := RegisterFileType(codec)
+	if err != nil {
+		t.Fatalf("register file type error: %s", err)
+	}
+	if ft.String() != "whtst" || stringToFileType("WHT") != ft || !IsFileTypePath("a.wht") {
+		t.Errorf("registered file type %s is not recognized", ft)
+	}
+	if _, err := RegisterFileType(codec); err == nil {
+		t.Error("expected an error registering an existing file type")
+	}
+	if _, err := RegisterFileType(FileTypeCodec{Name: "jpeg", Encode: codec.Encode}); err == nil {
+		t.Error("expected an error registering a core file type")
+	}
+	if a := AvailableFileTypes(); a[len(a)-1] != ft {
+		t.Errorf("expected %s among the available file types, got %v", ft, a)
+	}
+
+	var wg sync.WaitGroup
+	var registered int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := RegisterFileType(FileTypeCodec{Name: "whrace", Encode: codec.Encode}); err == nil {
+				atomic.AddInt32(&registered, 1)
+			}
+			AvailableFileTypes()
+		}()
+	}
+	wg.Wait()
+	if registered != 1 {
+		t.Errorf("expected one of concurrent registrations of a name to succeed, %d did", registered)
+	}
+
+	path := "/tmp/test-warhola-registered.wht"
+	defer os.Remove(path)
+	c := newEncodeCanvas(t, path, "")
+	want := color.RGBAModel.Convert(c.At(9, 17))
+	if err := c.Save(); err != nil {
+		t.Fatalf("registered file type save error: %s", err)
+	}
+	o, err := New(SetPath(path, ""))
+	if err != nil {
+		t.Fatalf("registered file type open error: %s", err)
+	}
+	if o.FileType() != "whtst" || o.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Errorf("expected a 64x64 whtst canvas, got %s %v", o.FileType(), o.Bounds())
+	}
+	if got := color.RGBAModel.Convert(o.At(9, 17)); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
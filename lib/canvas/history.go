@@ -0,0 +1,147 @@
+package canvas
+
+import (
+	"image"
+
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+// An interface for stepping back and forth through the prior states of a
+// canvas, where the canvas is configured to keep a history.
+type Historian interface {
+	Undo() error
+	Redo() error
+	History() []State
+}
+
+// A state of the canvas held in its history: the operation producing it, the
+// image of the state, and whether it is the current state of the canvas.
+type State struct {
+	Operation string
+	Image     image.Image
+	Current   bool
+}
+
+type state struct {
+	op     string
+	frames []*pxl
+}
+
+type history struct {
+	limit  int
+	states []*state
+	at     int
+}
+
+func newHistory(limit int) *history {
+	return &history{limit: limit}
+}
+
+func (h *history) enabled() bool {
+	return h != nil && h.limit > 0
+}
+
+func (h *history) clone() *history {
+	if h == nil {
+		return nil
+	}
+	return newHistory(h.limit)
+}
+
+func (c *canvas) snapshot(op string) *state {
+	if c.anim == nil {
+		return &state{op, []*pxl{c.pxl}}
+	}
+	s := &state{op: op}
+	for _, f := range c.anim.frames {
+		s.frames = append(s.frames, f.pxl)
+	}
+	return s
+}
+
+// copy provides a state of copies of the frames of the state.
+func (s *state) copy() *state {
+	ret := &state{op: s.op}
+	for _, f := range s.frames {
+		ret.frames = append(ret.frames, f.clone(f.ColorModel()))
+	}
+	return ret
+}
+
+// record adds a copy of the current canvas state, produced by op, to the
+// history after the current position, discarding any undone states and the
+// oldest states past the history limit. Held as copies, states are unchanged by
+// any later in place change to the canvas.
+func (c *canvas) record(prior *state, op string) {
+	h := c.hist
+	if len(h.states) == 0 {
+		h.states = append(h.states, prior.copy())
+	}
+	h.states = append(h.states[:h.at+1], c.snapshot(op).copy())
+	if over := len(h.states) - (h.limit + 1); over > 0 {
+		h.states = h.states[over:]
+	}
+	h.at = len(h.states) - 1
+}
+
+// restore sets a copy of the state as the canvas state, leaving the state held
+// in the history unchanged by any later in place changes.
+func (c *canvas) restore(s *state) {
+	cp := func(p *pxl) *pxl { return p.clone(p.ColorModel()) }
+	if c.anim == nil {
+		c.pxl = cp(s.frames[0])
+		return
+	}
+	for i, f := range c.anim.frames {
+		f.pxl = cp(s.frames[i])
+	}
+	c.pxl = c.anim.frames[0].pxl
+}
+
+var (
+	HistoryDisabledError = xrr.Xrror("canvas history is not enabled")
+	NoUndoError          = xrr.Xrror("nothing to undo")
+	NoRedoError          = xrr.Xrror("nothing to redo")
+)
+
+// Return the canvas to the state before the last operation.
+func (c *canvas) Undo() error {
+	switch {
+	case !c.hist.enabled():
+		return HistoryDisabledError
+	case c.hist.at == 0:
+		return NoUndoError
+	}
+	c.Printf("undo %s", c.hist.states[c.hist.at].op)
+	c.hist.at--
+	c.restore(c.hist.states[c.hist.at])
+	return nil
+}
+
+// Return the canvas to the state after the last undone operation.
+func (c *canvas) Redo() error {
+	switch {
+	case !c.hist.enabled():
+		return HistoryDisabledError
+	case c.hist.at >= len(c.hist.states)-1:
+		return NoRedoError
+	}
+	c.hist.at++
+	c.restore(c.hist.states[c.hist.at])
+	c.Printf("redo %s", c.hist.states[c.hist.at].op)
+	return nil
+}
+
+// The states held in the canvas history, from the oldest, with the image of
+// the first frame of each state. The images are those held by the history and
+// are not to be changed.
+func (c *canvas) History() []State {
+	var ret []State
+	if !c.hist.enabled() {
+		return ret
+	}
+	for i, s := range c.hist.states {
+		ret = append(ret, State{s.op, s.frames[0], i == c.hist.at})
+	}
+	return ret
+}
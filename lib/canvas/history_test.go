@@ -0,0 +1,108 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	id := "History"
+	c, err := New(
+		SetColorModel("RGBA"),
+		SetPath("/tmp/test-warhola-history.png", ""),
+		SetRect(8, 4),
+		SetHistory(2),
+	)
+	if err != nil {
+		t.Fatalf("history canvas error: %s", err)
+	}
+	invert := func(c color.RGBA) color.RGBA {
+		return color.RGBA{255 - c.R, 255 - c.G, 255 - c.B, c.A}
+	}
+	size := func(w, h int) {
+		if got := c.Bounds().Size(); got != image.Pt(w, h) {
+			failProbe(t, id, "size", commonExpect, image.Pt(w, h), got)
+		}
+	}
+
+	if err = c.Undo(); err == nil {
+		failProbe(t, id, "undo", "expected an error with no history")
+	}
+	c.Adjust(invert)
+	c.Crop(image.Rect(0, 0, 4, 4))
+	c.Resize(2, 2, NearestNeighbor)
+	size(2, 2)
+
+	h := c.History()
+	if len(h) != 3 {
+		t.Fatalf("expected a history of 3 states, got %d", len(h))
+	}
+	if h[0].Operation != "adjust" || h[1].Operation != "crop (0,0)-(4,4)" || !h[2].Current {
+		failProbe(t, id, "history", "unexpected history %v", h)
+	}
+
+	if err = c.Undo(); err != nil {
+		failProbe(t, id, "undo", "unexpected error %s", err)
+	}
+	size(4, 4)
+	c.Undo()
+	size(8, 4)
+	if err = c.Undo(); err == nil {
+		failProbe(t, id, "undo", "expected an error past the history limit")
+	}
+	if got := rgbaAt(c, 0, 0); got.R != 255 {
+		failProbe(t, id, "undo", "expected the adjusted state, got %v", got)
+	}
+
+	c.Redo()
+	size(4, 4)
+	c.Flip(THorizontal)
+	if err = c.Redo(); err == nil {
+		failProbe(t, id, "redo", "expected an error after a new operation")
+	}
+	if h = c.History(); h[len(h)-1].Operation != "flip" {
+		failProbe(t, id, "history", commonExpect, "flip", h[len(h)-1].Operation)
+	}
+
+	dc, _ := New(
+		SetColorModel("RGBA"),
+		SetPath("/tmp/test-warhola-history.png", ""),
+		SetRect(4, 4),
+		SetHistory(4),
+	)
+	blue := color.RGBA{0, 0, 255, 255}
+	dc.Adjust(func(color.RGBA) color.RGBA { return color.RGBA{255, 0, 0, 255} })
+	dc.Draw("text", func(d draw.Image) error {
+		d.Set(0, 0, blue)
+		return nil
+	})
+	if h = dc.History(); len(h) != 3 || h[2].Operation != "text" {
+		failProbe(t, id, "draw", "expected the draw recorded as its own step, got %v", h)
+	}
+	dc.Undo()
+	if got := rgbaAt(dc, 0, 0); got != (color.RGBA{255, 0, 0, 255}) {
+		failProbe(t, id, "draw undo", "expected the adjusted state, got %v", got)
+	}
+	dc.Redo()
+	if got := rgbaAt(dc, 0, 0); got != blue {
+		failProbe(t, id, "draw redo", commonExpect, blue, got)
+	}
+	dc.Set(1, 1, blue)
+	dc.Undo()
+	dc.Redo()
+	if got := rgbaAt(dc, 1, 1); got == blue {
+		failProbe(t, id, "in place", "expected a change in place to leave the history unchanged")
+	}
+
+	nc, _ := New(
+		SetColorModel("RGBA"),
+		SetPath("/tmp/test-warhola-history.png", ""),
+		SetRect(8, 4),
+	)
+	nc.Adjust(invert)
+	if err = nc.Undo(); err != HistoryDisabledError {
+		failProbe(t, id, "disabled", commonExpect, HistoryDisabledError, err)
+	}
+}
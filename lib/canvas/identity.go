@@ -14,7 +14,7 @@ type identity struct {
 
 func newIdentity() *identity {
 	return &identity{
-		&pather{""}, ACTIONNOOP, FILETYPENOOP,
+		&pather{path: ""}, ACTIONNOOP, FILETYPENOOP,
 	}
 }
 
@@ -22,10 +22,12 @@ func newIdentity() *identity {
 type Pather interface {
 	Path() string
 	SetPath(string)
+	InPath() string
 }
 
 type pather struct {
-	path string
+	path, in string
+	memory   bool
 }
 
 // A default path.
@@ -36,9 +38,16 @@ func (p *pather) Path() string {
 	return p.path
 }
 
-// Sets the provided string as this *pathers path.
+// Sets the provided string as this *pathers path, which is no longer held
+// only in memory.
 func (p *pather) SetPath(as string) {
-	p.path = as
+	p.path, p.memory = as, false
+}
+
+// Returns the path this *pather was opened or created from, which differs from
+// its path where it is written elsewhere.
+func (p *pather) InPath() string {
+	return p.in
 }
 
 func (p *pather) clone() *pather {
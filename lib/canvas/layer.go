@@ -0,0 +1,256 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/util/prl"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+// A single layer of a Layers stack: an image placed at an offset over the
+// canvas, composited with the named blend mode at an opacity of 0-100.
+type Layer struct {
+	Name    string
+	Offset  image.Point
+	Opacity float64
+	Visible bool
+	Mode    string
+	p       *pxl
+}
+
+// Provides a new visible, fully opaque, normal mode Layer of the provided image.
+func NewLayer(name string, i image.Image) (*Layer, error) {
+	p := newPxl()
+	p.m = WorkingColorModel
+	if _, err := existingTo(i, p); err != nil {
+		return nil, err
+	}
+	return &Layer{name, image.ZP, 100, true, "normal", p}, nil
+}
+
+// The image of the layer.
+func (l *Layer) Image() image.Image {
+	return l.p
+}
+
+// The bounds of the layer, at its offset, in canvas coordinates.
+func (l *Layer) Bounds() image.Rectangle {
+	return l.p.Bounds().Sub(l.p.Bounds().Min).Add(l.Offset)
+}
+
+// A function providing the BlendFunc for a named blend mode.
+type BlendResolver func(mode string) BlendFunc
+
+// A stack of Layer, ordered from the bottom layer at index 0.
+type Layers struct {
+	has []*Layer
+}
+
+// Provides a new empty Layers.
+func NewLayers() *Layers {
+	return &Layers{make([]*Layer, 0)}
+}
+
+var LayerIndexError = xrr.Xrror("no layer at index %d of %d layers").Out
+
+func (l *Layers) check(i int) error {
+	if i < 0 || i >= len(l.has) {
+		return LayerIndexError(i, len(l.has))
+	}
+	return nil
+}
+
+// The number of layers.
+func (l *Layers) Len() int {
+	return len(l.has)
+}
+
+// The layer at index i.
+func (l *Layers) Get(i int) (*Layer, error) {
+	if err := l.check(i); err != nil {
+		return nil, err
+	}
+	return l.has[i], nil
+}
+
+// Insert the layer at index i, or at the top for any index out of range.
+func (l *Layers) Add(i int, ly *Layer) {
+	if i < 0 || i >= len(l.has) {
+		l.has = append(l.has, ly)
+		return
+	}
+	l.has = append(l.has, nil)
+	copy(l.has[i+1:], l.has[i:])
+	l.has[i] = ly
+}
+
+// Move the layer at index from to index to.
+func (l *Layers) Move(from, to int) error {
+	if err := l.check(from); err != nil {
+		return err
+	}
+	if err := l.check(to); err != nil {
+		return err
+	}
+	ly := l.has[from]
+	l.has = append(l.has[:from], l.has[from+1:]...)
+	l.Add(to, ly)
+	return nil
+}
+
+// Remove the layer at index i.
+func (l *Layers) Remove(i int) error {
+	if err := l.check(i); err != nil {
+		return err
+	}
+	l.has = append(l.has[:i], l.has[i+1:]...)
+	return nil
+}
+
+// Merge the layer at index i down onto the layer below it, which keeps its own
+// name, mode, opacity and visibility.
+func (l *Layers) Merge(i int, fn BlendResolver) error {
+	if err := l.check(i); err != nil {
+		return err
+	}
+	if err := l.check(i - 1); err != nil {
+		return err
+	}
+	up, dn := l.has[i], l.has[i-1]
+	r := up.Bounds().Union(dn.Bounds())
+	dst := scratch(dn.p, WorkingColorModelFn, r.Dx(), r.Dy())
+	composite(dst, dn.p, dn.Offset.Sub(r.Min), 100, func(_, fg RGBA164) RGBA164 { return fg })
+	if up.Visible {
+		composite(dst, up.p, up.Offset.Sub(r.Min), up.Opacity, fn(up.Mode))
+	}
+	dn.p, dn.Offset = dst, r.Min
+	return l.Remove(i)
+}
+
+// composite blends src at offset at onto dst in place, with the alpha of src
+// scaled by opacity.
+func composite(dst, src *pxl, at image.Point, opacity float64, bfn BlendFunc) {
+	s := src.clone(WorkingColorModelFn)
+	r := dst.Bounds().Intersect(s.Bounds().Sub(s.Bounds().Min).Add(at))
+	if r.Empty() {
+		return
+	}
+	o := opacity / 100
+	prl.Run(r.Dy(), func(start, end int) {
+		for y := r.Min.Y + start; y < r.Min.Y+end; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				dPos := y*dst.str + x*4
+				sPos := (y-at.Y)*s.str + (x-at.X)*4
+				fg := newRGBA164(s.pix[sPos+0], s.pix[sPos+1], s.pix[sPos+2], s.pix[sPos+3])
+				fg.A = fg.A * o
+				result := bfn(
+					newRGBA164(dst.pix[dPos+0], dst.pix[dPos+1], dst.pix[dPos+2], dst.pix[dPos+3]),
+					fg,
+				)
+				result.Clamp()
+				dst.pix[dPos+0] = uint8(result.R * 255)
+				dst.pix[dPos+1] = uint8(result.G * 255)
+				dst.pix[dPos+2] = uint8(result.B * 255)
+				dst.pix[dPos+3] = uint8(result.A * 255)
+			}
+		}
+	})
+}
+
+// An interface for compositing a Layers stack onto a canvas.
+type Flattener interface {
+	Flatten(*Layers, BlendResolver) error
+}
+
+// Composite every visible layer, from the bottom, onto the canvas with the
+// BlendFunc the provided BlendResolver gives for the layer mode.
+func (c *canvas) Flatten(l *Layers, fn BlendResolver) error {
+	return c.mutate("flatten", func() (*pxl, error) {
+		return flatten(c.pxl, l, fn)
+	})
+}
+
+func flatten(p *pxl, l *Layers, fn BlendResolver) (*pxl, error) {
+	return mutate(p, func() (*pxl, error) {
+		dst := p.clone(WorkingColorModelFn)
+		for _, ly := range l.has {
+			if ly.Visible {
+				composite(dst, ly.p, ly.Offset, ly.Opacity, fn(ly.Mode))
+			}
+		}
+		return dst, nil
+	})
+}
+
+// The path of the sidecar file persisting the layers of the file at path.
+func LayersPath(path string) string {
+	return path + ".layers"
+}
+
+type layerFile struct {
+	Name    string      `json:"name"`
+	Offset  image.Point `json:"offset"`
+	Opacity float64     `json:"opacity"`
+	Visible bool        `json:"visible"`
+	Mode    string      `json:"mode"`
+	Data    []byte      `json:"data"`
+}
+
+// Opens the Layers stored in the sidecar file of the file at path, providing
+// empty Layers where there is no sidecar file.
+func OpenLayers(path string) (*Layers, error) {
+	ret := NewLayers()
+	b, err := ioutil.ReadFile(LayersPath(path))
+	switch {
+	case os.IsNotExist(err):
+		return ret, nil
+	case err != nil:
+		return nil, err
+	}
+	var lf []layerFile
+	if err = json.Unmarshal(b, &lf); err != nil {
+		return nil, err
+	}
+	for _, f := range lf {
+		i, err := png.Decode(bytes.NewReader(f.Data))
+		if err != nil {
+			return nil, err
+		}
+		ly, err := NewLayer(f.Name, i)
+		if err != nil {
+			return nil, err
+		}
+		ly.Offset, ly.Opacity, ly.Visible, ly.Mode = f.Offset, f.Opacity, f.Visible, f.Mode
+		ret.has = append(ret.has, ly)
+	}
+	return ret, nil
+}
+
+// Saves the Layers to the sidecar file of the file at path, removing the
+// sidecar file when there are no layers.
+func (l *Layers) Save(path string) error {
+	lp := LayersPath(path)
+	if len(l.has) == 0 {
+		if err := os.Remove(lp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var lf []layerFile
+	for _, ly := range l.has {
+		var b bytes.Buffer
+		if err := png.Encode(&b, ly.p); err != nil {
+			return err
+		}
+		lf = append(lf, layerFile{ly.Name, ly.Offset, ly.Opacity, ly.Visible, ly.Mode, b.Bytes()})
+	}
+	return writeFile(lp, false, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(lf)
+	})
+}
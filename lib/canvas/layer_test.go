@@ -0,0 +1,126 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+)
+
+func solid(c color.RGBA, w, h int) *pxl {
+	p := Scratch(color.RGBAModel, w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p.Set(x, y, c)
+		}
+	}
+	return p
+}
+
+func normalResolver(string) BlendFunc {
+	return func(bg, fg RGBA164) RGBA164 {
+		a := fg.A + bg.A*(1-fg.A)
+		if a == 0 {
+			return RGBA164{}
+		}
+		return RGBA164{
+			R: (fg.R*fg.A + bg.R*bg.A*(1-fg.A)) / a,
+			G: (fg.G*fg.A + bg.G*bg.A*(1-fg.A)) / a,
+			B: (fg.B*fg.A + bg.B*bg.A*(1-fg.A)) / a,
+			A: a,
+		}
+	}
+}
+
+func rgbaAt(i image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(i.At(x, y)).(color.RGBA)
+}
+
+func TestLayers(t *testing.T) {
+	id := "Layers"
+	red, blue := color.RGBA{0xFF, 0, 0, 0xFF}, color.RGBA{0, 0, 0xFF, 0xFF}
+
+	l := NewLayers()
+	r, _ := NewLayer("red", solid(red, 4, 4))
+	b, _ := NewLayer("blue", solid(blue, 4, 4))
+	b.Offset = image.Pt(2, 2)
+	l.Add(0, r)
+	l.Add(-1, b)
+	if l.Len() != 2 {
+		failProbe(t, id, "add", commonExpect, 2, l.Len())
+	}
+
+	p := solid(color.RGBA{0, 0, 0, 0xFF}, 8, 8)
+	f, err := flatten(p, l, normalResolver)
+	if err != nil {
+		t.Fatalf("flatten error: %s", err)
+	}
+	for _, v := range []struct {
+		at   image.Point
+		want color.RGBA
+	}{
+		{image.Pt(0, 0), red},
+		{image.Pt(3, 3), blue},
+		{image.Pt(6, 6), color.RGBA{0, 0, 0, 0xFF}},
+	} {
+		if got := rgbaAt(f, v.at.X, v.at.Y); got != v.want {
+			failProbe(t, id, "flatten", "at %v "+commonExpect, v.at, v.want, got)
+		}
+	}
+
+	b.Visible = false
+	f, _ = flatten(p, l, normalResolver)
+	if got := rgbaAt(f, 3, 3); got != red {
+		failProbe(t, id, "hidden", commonExpect, red, got)
+	}
+	b.Visible, b.Opacity = true, 0
+	f, _ = flatten(p, l, normalResolver)
+	if got := rgbaAt(f, 3, 3); got != red {
+		failProbe(t, id, "opacity", commonExpect, red, got)
+	}
+	b.Opacity = 100
+
+	if err = l.Move(1, 0); err != nil {
+		failProbe(t, id, "move", "unexpected error %s", err)
+	}
+	if ly, _ := l.Get(0); ly.Name != "blue" {
+		failProbe(t, id, "move", commonExpect, "blue", ly.Name)
+	}
+	if err = l.Move(0, 2); err == nil {
+		failProbe(t, id, "move", "expected an index error")
+	}
+	l.Move(1, 0)
+
+	path := "/tmp/test-warhola-layers.png"
+	if err = l.Save(path); err != nil {
+		t.Fatalf("layers save error: %s", err)
+	}
+	o, err := OpenLayers(path)
+	if err != nil {
+		t.Fatalf("layers open error: %s", err)
+	}
+	if o.Len() != 2 {
+		failProbe(t, id, "open", commonExpect, 2, o.Len())
+	}
+	if ly, _ := o.Get(1); ly.Name != "blue" || ly.Offset != image.Pt(2, 2) || ly.Mode != "normal" {
+		failProbe(t, id, "open", "unexpected layer %s at %v mode %s", ly.Name, ly.Offset, ly.Mode)
+	}
+
+	if err = o.Merge(1, normalResolver); err != nil {
+		failProbe(t, id, "merge", "unexpected error %s", err)
+	}
+	m, _ := o.Get(0)
+	if m.Name != "red" || m.Bounds() != image.Rect(0, 0, 6, 6) {
+		failProbe(t, id, "merge", "unexpected merged layer %s with bounds %v", m.Name, m.Bounds())
+	}
+	if got := rgbaAt(m.Image(), 3, 3); got != blue {
+		failProbe(t, id, "merge", commonExpect, blue, got)
+	}
+
+	if err = NewLayers().Save(path); err != nil {
+		failProbe(t, id, "save empty", "unexpected error %s", err)
+	}
+	if _, err = os.Stat(LayersPath(path)); !os.IsNotExist(err) {
+		failProbe(t, id, "save empty", "expected the sidecar to be removed")
+	}
+}
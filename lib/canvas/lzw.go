@@ -0,0 +1,162 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+
+	"github.com/Laughs-In-Flowers/xrr"
+	"golang.org/x/image/tiff"
+)
+
+const (
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagStripByteCounts = 279
+	tagPredictor       = 317
+	tiffLZWCompression = 5
+	tiffHorizontal     = 2
+)
+
+var tiffStripError = xrr.Xrror("unable to encode tiff: no single strip of pixel data")
+
+// encodeTiffLZW writes an lzw compressed tiff of the image. The image is
+// encoded uncompressed in a single strip, of which the pixel data is
+// compressed and IFD0 rewritten to describe it.
+func encodeTiffLZW(w io.Writer, i image.Image, predictor bool) error {
+	var b bytes.Buffer
+	if err := tiff.Encode(&b, i, nil); err != nil {
+		return err
+	}
+	raw := b.Bytes()
+	bo, es := readIFD0(raw)
+	if bo == nil {
+		return tiffStripError
+	}
+	off, n := findEntry(es, tagStripOffsets), findEntry(es, tagStripByteCounts)
+	if off == nil || n == nil || off.count != 1 || off.uint()+n.uint() > len(raw) {
+		return tiffStripError
+	}
+	strip := raw[off.uint() : off.uint()+n.uint()]
+	if predictor {
+		bits, spp := 8, 1
+		if e := findEntry(es, tagBitsPerSample); e != nil {
+			bits = int(binary.BigEndian.Uint16(e.data))
+		}
+		if e := findEntry(es, tagSamplesPerPixel); e != nil {
+			spp = e.uint()
+		}
+		tiffPredict(bo, strip, i.Bounds().Dx(), spp, bits)
+		es = setEntry(es, shortEntry(tagPredictor, tiffHorizontal))
+	}
+	data := tiffLZW(strip)
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+	es = setEntry(es, shortEntry(tagCompression, tiffLZWCompression))
+	es = setEntry(es, longEntry(tagStripOffsets, 8))
+	es = setEntry(es, longEntry(tagStripByteCounts, len(data)))
+
+	ret := make([]byte, 8, 8+len(data))
+	copy(ret, raw[:4])
+	bo.PutUint32(ret[4:], uint32(8+len(data)))
+	ret = append(ret, data...)
+	_, err := w.Write(append(ret, serializeIFD(bo, es, len(ret))...))
+	return err
+}
+
+// tiffPredict applies the horizontal differencing predictor in place to rows
+// of width pixels of spp samples, each of 8 or 16 bits.
+func tiffPredict(bo binary.ByteOrder, b []byte, width, spp, bits int) {
+	row := width * spp * bits / 8
+	if row == 0 {
+		return
+	}
+	for at := 0; at+row <= len(b); at += row {
+		r := b[at : at+row]
+		switch bits {
+		case 8:
+			for i := len(r) - 1; i >= spp; i-- {
+				r[i] -= r[i-spp]
+			}
+		case 16:
+			for i := len(r)/2 - 1; i >= spp; i-- {
+				bo.PutUint16(r[2*i:], bo.Uint16(r[2*i:])-bo.Uint16(r[2*(i-spp):]))
+			}
+		}
+	}
+}
+
+// tiffLZW compresses the provided bytes with the lzw of tiff: codes are
+// written most significant bit first, from a clear code to an end code, and
+// widen one code earlier than in standard lzw.
+func tiffLZW(b []byte) []byte {
+	const (
+		clear    = 256
+		eoi      = 257
+		maxWidth = 12
+		maxCode  = 1<<maxWidth - 2
+	)
+	var (
+		out   []byte
+		acc   uint32
+		nBits uint
+		width uint = 9
+		hi    uint16
+		table map[uint32]uint16
+	)
+	write := func(code uint16) {
+		acc |= uint32(code) << (32 - width - nBits)
+		nBits += width
+		for nBits >= 8 {
+			out = append(out, byte(acc>>24))
+			acc <<= 8
+			nBits -= 8
+		}
+	}
+	reset := func() {
+		write(clear)
+		width, hi = 9, eoi
+		table = make(map[uint32]uint16)
+	}
+	// next assigns the next code, reporting false where the codes ran out
+	// and the table was reset.
+	next := func() bool {
+		hi++
+		if hi+1 == 1<<width && width < maxWidth {
+			width++
+		}
+		if hi == maxCode {
+			reset()
+			return false
+		}
+		return true
+	}
+
+	reset()
+	if len(b) > 0 {
+		code := uint16(b[0])
+		for _, x := range b[1:] {
+			key := uint32(code)<<8 | uint32(x)
+			if c, ok := table[key]; ok {
+				code = c
+				continue
+			}
+			write(code)
+			if next() {
+				table[key] = hi
+			}
+			code = uint16(x)
+		}
+		write(code)
+		next()
+	}
+	write(eoi)
+	if nBits > 0 {
+		out = append(out, byte(acc>>24))
+	}
+	return out
+}
@@ -36,6 +36,11 @@ var (
 	AvailablePPU []string = []string{defaultPPU, "mm", "inch"} //
 )
 
+// Provides a Measure of the provided rectangle at pp points per ppu unit.
+func NewMeasure(r image.Rectangle, pp float64, ppu string) Measure {
+	return newMeasure(&r, pp, ppu)
+}
+
 func newMeasure(r *image.Rectangle, ppIn float64, ppu string) *measure {
 	m := &measure{
 		r:   r,
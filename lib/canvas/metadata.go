@@ -0,0 +1,442 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"sort"
+)
+
+// metadata holds the exif and xmp of an opened file, with exif kept as the
+// entries of IFD0 and its exif and gps sub IFDs.
+type metadata struct {
+	ifd0, exif, gps []*ifdEntry
+	xmp             []byte
+	orientation     int
+}
+
+const (
+	tagOrientation  = 274
+	tagXMP          = 700
+	tagExifIFD      = 34665
+	tagGPSIFD       = 34853
+	tagInteropIFD   = 40965
+	tagPixelXDim    = 40962
+	tagPixelYDim    = 40963
+	tagImageWidth   = 256
+	tagImageLength  = 257
+	tiffByte        = 1
+	tiffUndefined   = 7
+	exifMarker      = 0xE1
+	orientationNone = 1
+)
+
+var (
+	exifIdentifier = []byte("Exif\x00\x00")
+	xmpIdentifier  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// Tags of IFD0 describing the layout of the pixel data of the file they came
+// from, these are never carried from one file to another.
+var structuralTags = map[uint16]bool{
+	254: true, 255: true, 256: true, 257: true, 258: true, 259: true,
+	262: true, 273: true, 277: true, 278: true, 279: true, 284: true,
+	317: true, 320: true, 322: true, 323: true, 324: true, 325: true,
+	330: true, 338: true, 339: true, 513: true, 514: true,
+	tiffXResolution: true, tiffYResolution: true, tiffResolutionUnit: true,
+	tagXMP: true, tagExifIFD: true, tagGPSIFD: true,
+}
+
+// An IFD entry, with data held big endian regardless of the source byte order.
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+	sub      []*ifdEntry
+	at       int // offset of the data in the file read, for rewriting in place
+}
+
+var tiffTypeSize = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+func tiffUnitSize(typ uint16) int {
+	switch typ {
+	case tiffRational, 10:
+		return 4
+	}
+	return tiffTypeSize[typ]
+}
+
+// swapOrder reverses the byte order of each unit of the provided type in d.
+func swapOrder(typ uint16, d []byte) []byte {
+	u := tiffUnitSize(typ)
+	ret := make([]byte, len(d))
+	copy(ret, d)
+	if u < 2 {
+		return ret
+	}
+	for i := 0; i+u <= len(ret); i += u {
+		for a, b := i, i+u-1; a < b; a, b = a+1, b-1 {
+			ret[a], ret[b] = ret[b], ret[a]
+		}
+	}
+	return ret
+}
+
+func tiffByteOrder(b []byte) binary.ByteOrder {
+	if len(b) < 8 {
+		return nil
+	}
+	switch string(b[:4]) {
+	case "II\x2A\x00":
+		return binary.LittleEndian
+	case "MM\x00\x2A":
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// readIFD reads the IFD at offset off of the provided tiff structured bytes.
+func readIFD(b []byte, bo binary.ByteOrder, off int) []*ifdEntry {
+	if off < 8 || off+2 > len(b) {
+		return nil
+	}
+	n := int(bo.Uint16(b[off:]))
+	var ret []*ifdEntry
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(b) {
+			break
+		}
+		tag, typ, count := bo.Uint16(b[e:]), bo.Uint16(b[e+2:]), bo.Uint32(b[e+4:])
+		ts, ok := tiffTypeSize[typ]
+		if !ok || count > uint32(len(b)) {
+			continue
+		}
+		size := ts * int(count)
+		at := e + 8
+		if size > 4 {
+			at = int(bo.Uint32(b[e+8:]))
+		}
+		if at < 0 || at+size > len(b) {
+			continue
+		}
+		d := b[at : at+size]
+		if bo == binary.LittleEndian {
+			d = swapOrder(typ, d)
+		} else {
+			d = append([]byte(nil), d...)
+		}
+		ret = append(ret, &ifdEntry{tag: tag, typ: typ, count: count, data: d, at: at})
+	}
+	return ret
+}
+
+// readIFD0 provides the byte order and the first IFD of the provided tiff
+// structured bytes, or a nil byte order where they are not.
+func readIFD0(b []byte) (binary.ByteOrder, []*ifdEntry) {
+	bo := tiffByteOrder(b)
+	if bo == nil {
+		return nil, nil
+	}
+	return bo, readIFD(b, bo, int(bo.Uint32(b[4:])))
+}
+
+func (e *ifdEntry) uint() int {
+	switch e.typ {
+	case tiffShort:
+		if len(e.data) >= 2 {
+			return int(binary.BigEndian.Uint16(e.data))
+		}
+	case tiffLong:
+		if len(e.data) >= 4 {
+			return int(binary.BigEndian.Uint32(e.data))
+		}
+	}
+	return 0
+}
+
+func findEntry(es []*ifdEntry, tag uint16) *ifdEntry {
+	for _, e := range es {
+		if e.tag == tag {
+			return e
+		}
+	}
+	return nil
+}
+
+// setEntry replaces the entry with the same tag, or appends it.
+func setEntry(es []*ifdEntry, n *ifdEntry) []*ifdEntry {
+	for i, e := range es {
+		if e.tag == n.tag {
+			es[i] = n
+			return es
+		}
+	}
+	return append(es, n)
+}
+
+func shortEntry(tag uint16, v int) *ifdEntry {
+	d := make([]byte, 2)
+	binary.BigEndian.PutUint16(d, uint16(v))
+	return &ifdEntry{tag: tag, typ: tiffShort, count: 1, data: d}
+}
+
+func longEntry(tag uint16, v int) *ifdEntry {
+	d := make([]byte, 4)
+	binary.BigEndian.PutUint32(d, uint32(v))
+	return &ifdEntry{tag: tag, typ: tiffLong, count: 1, data: d}
+}
+
+func rationalEntry(tag uint16, v float64) *ifdEntry {
+	d := make([]byte, 8)
+	binary.BigEndian.PutUint32(d, uint32(math.Round(v*100)))
+	binary.BigEndian.PutUint32(d[4:], 100)
+	return &ifdEntry{tag: tag, typ: tiffRational, count: 1, data: d}
+}
+
+// serializeIFD provides the bytes of an IFD and all of its entry data, for an
+// IFD placed at offset base of a file in byte order bo.
+func serializeIFD(bo binary.ByteOrder, es []*ifdEntry, base int) []byte {
+	sort.Slice(es, func(i, j int) bool { return es[i].tag < es[j].tag })
+	head := make([]byte, 2+12*len(es)+4)
+	bo.PutUint16(head, uint16(len(es)))
+	start := base + len(head)
+	var tail []byte
+	var subs []int
+	for i, e := range es {
+		at := 2 + i*12
+		bo.PutUint16(head[at:], e.tag)
+		bo.PutUint16(head[at+2:], e.typ)
+		bo.PutUint32(head[at+4:], e.count)
+		if e.sub != nil {
+			subs = append(subs, i)
+			continue
+		}
+		d := e.data
+		if bo == binary.LittleEndian {
+			d = swapOrder(e.typ, d)
+		}
+		if len(d) <= 4 {
+			copy(head[at+8:at+12], d)
+			continue
+		}
+		bo.PutUint32(head[at+8:], uint32(start+len(tail)))
+		tail = append(tail, d...)
+		if len(tail)%2 != 0 {
+			tail = append(tail, 0)
+		}
+	}
+	for _, i := range subs {
+		off := start + len(tail)
+		bo.PutUint32(head[2+i*12+8:], uint32(off))
+		tail = append(tail, serializeIFD(bo, es[i].sub, off)...)
+	}
+	return append(head, tail...)
+}
+
+// parseExif reads the metadata of tiff structured bytes, either an exif block
+// or an entire tiff file.
+func parseExif(b []byte, m *metadata) {
+	bo, es := readIFD0(b)
+	if bo == nil {
+		return
+	}
+	m.ifd0 = es
+	if e := findEntry(m.ifd0, tagExifIFD); e != nil {
+		m.exif = readIFD(b, bo, e.uint())
+	}
+	if e := findEntry(m.ifd0, tagGPSIFD); e != nil {
+		m.gps = readIFD(b, bo, e.uint())
+	}
+	if e := findEntry(m.ifd0, tagOrientation); e != nil {
+		m.orientation = e.uint()
+	}
+	if e := findEntry(m.ifd0, tagXMP); e != nil && m.xmp == nil {
+		m.xmp = e.data
+	}
+}
+
+// readMetadata provides any exif or xmp metadata of the provided encoded bytes
+// of FileType t, or nil.
+func readMetadata(t FileType, b []byte) *metadata {
+	m := &metadata{orientation: orientationNone}
+	switch t {
+	case JPG:
+		for _, s := range jpgSegments(b) {
+			if s.marker != exifMarker {
+				continue
+			}
+			switch {
+			case bytes.HasPrefix(s.data, exifIdentifier):
+				parseExif(s.data[len(exifIdentifier):], m)
+			case bytes.HasPrefix(s.data, xmpIdentifier):
+				m.xmp = append([]byte(nil), s.data[len(xmpIdentifier):]...)
+			}
+		}
+	case TIFF:
+		parseExif(b, m)
+	default:
+		return nil
+	}
+	if m.ifd0 == nil && m.xmp == nil {
+		return nil
+	}
+	if m.orientation < 1 || m.orientation > 8 {
+		m.orientation = orientationNone
+	}
+	return m
+}
+
+// entries provides the IFD0 entries to carry to a file of the provided bounds,
+// with orientation and pixel dimensions reflecting the current pixel data.
+func (m *metadata) entries(r image.Rectangle) []*ifdEntry {
+	var ret []*ifdEntry
+	for _, e := range m.ifd0 {
+		if !structuralTags[e.tag] {
+			ret = append(ret, e)
+		}
+	}
+	ret = setEntry(ret, shortEntry(tagOrientation, m.orientation))
+	if len(m.exif) > 0 {
+		var ex []*ifdEntry
+		for _, e := range m.exif {
+			if e.tag != tagInteropIFD {
+				ex = append(ex, e)
+			}
+		}
+		ex = setEntry(ex, longEntry(tagPixelXDim, r.Dx()))
+		ex = setEntry(ex, longEntry(tagPixelYDim, r.Dy()))
+		ret = append(ret, &ifdEntry{tag: tagExifIFD, typ: tiffLong, count: 1, sub: ex})
+	}
+	if len(m.gps) > 0 {
+		ret = append(ret, &ifdEntry{tag: tagGPSIFD, typ: tiffLong, count: 1, sub: m.gps})
+	}
+	return ret
+}
+
+// writeMetadata returns the provided encoded bytes of FileType t with the
+// metadata written to them, for jpeg and tiff.
+func writeMetadata(t FileType, b []byte, p *pxl, m *metadata) []byte {
+	if m == nil {
+		return b
+	}
+	switch t {
+	case JPG:
+		return jpgMetadata(b, p, m)
+	case TIFF:
+		return tiffMetadata(b, p, m)
+	}
+	return b
+}
+
+func jpgAPP1(prefix, data []byte) []byte {
+	l := 2 + len(prefix) + len(data)
+	if l > math.MaxUint16 {
+		return nil
+	}
+	s := []byte{0xFF, exifMarker, byte(l >> 8), byte(l)}
+	s = append(s, prefix...)
+	return append(s, data...)
+}
+
+// jpgMetadata inserts exif and xmp APP1 segments after any JFIF APP0 segment.
+func jpgMetadata(b []byte, p *pxl, m *metadata) []byte {
+	if len(b) < 2 {
+		return b
+	}
+	var ins []byte
+	if m.ifd0 != nil {
+		es := m.entries(p.Bounds())
+		if p.measure != nil && p.ppi > 0 {
+			unit, d := 2, p.ppi
+			if p.metric() {
+				unit, d = 3, p.ppc
+			}
+			es = append(es,
+				rationalEntry(tiffXResolution, d),
+				rationalEntry(tiffYResolution, d),
+				shortEntry(tiffResolutionUnit, unit),
+			)
+		}
+		bo := binary.BigEndian
+		blob := []byte("MM\x00\x2A\x00\x00\x00\x08")
+		blob = append(blob, serializeIFD(bo, es, 8)...)
+		ins = append(ins, jpgAPP1(exifIdentifier, blob)...)
+	}
+	if m.xmp != nil {
+		ins = append(ins, jpgAPP1(xmpIdentifier, m.xmp)...)
+	}
+	at := 2
+	for _, s := range jpgSegments(b) {
+		if s.marker == jpgAPP0 {
+			at = s.end
+		}
+	}
+	ret := make([]byte, 0, len(b)+len(ins))
+	ret = append(ret, b[:at]...)
+	ret = append(ret, ins...)
+	return append(ret, b[at:]...)
+}
+
+// tiffMetadata rewrites IFD0 of an encoded tiff, with the metadata entries
+// added, at the end of the file.
+func tiffMetadata(b []byte, p *pxl, m *metadata) []byte {
+	bo, es := readIFD0(b)
+	if bo == nil {
+		return b
+	}
+	for _, e := range m.entries(p.Bounds()) {
+		if findEntry(es, e.tag) == nil || e.tag == tagOrientation {
+			es = setEntry(es, e)
+		}
+	}
+	if m.xmp != nil {
+		es = setEntry(es, &ifdEntry{tag: tagXMP, typ: tiffByte, count: uint32(len(m.xmp)), data: m.xmp})
+	}
+	ret := append([]byte(nil), b...)
+	if len(ret)%2 != 0 {
+		ret = append(ret, 0)
+	}
+	bo.PutUint32(ret[4:], uint32(len(ret)))
+	return append(ret, serializeIFD(bo, es, len(ret))...)
+}
+
+// orient applies the Flip and Rotate corresponding to the exif orientation of
+// the canvas, leaving the canvas with an orientation of 1 and no history of the
+// change.
+func orient(c *canvas) error {
+	if c.meta == nil {
+		return nil
+	}
+	h := c.hist
+	c.hist = nil
+	defer func() { c.hist = h }()
+	var err error
+	switch c.meta.orientation {
+	case 2:
+		err = c.Flip(THorizontal)
+	case 3:
+		err = c.Rotate(180, true, image.ZP)
+	case 4:
+		err = c.Flip(TVertical)
+	case 5:
+		if err = c.Rotate(90, true, image.ZP); err == nil {
+			err = c.Flip(THorizontal)
+		}
+	case 6:
+		err = c.Rotate(90, true, image.ZP)
+	case 7:
+		if err = c.Rotate(90, true, image.ZP); err == nil {
+			err = c.Flip(TVertical)
+		}
+	case 8:
+		err = c.Rotate(270, true, image.ZP)
+	}
+	if err == nil {
+		c.meta.orientation = orientationNone
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func asciiEntry(tag uint16, s string) *ifdEntry {
+	d := append([]byte(s), 0)
+	return &ifdEntry{tag: tag, typ: 2, count: uint32(len(d)), data: d}
+}
+
+// writeOriented writes a 16x8 jpeg with a red top left block and the provided
+// exif orientation to path.
+func writeOriented(t *testing.T, path string, orientation int) {
+	p := Scratch(color.RGBAModel, 16, 8)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			c := color.RGBA{0, 0, 0xFF, 0xFF}
+			if x < 4 && y < 4 {
+				c = color.RGBA{0xFF, 0, 0, 0xFF}
+			}
+			p.Set(x, y, c)
+		}
+	}
+	var b bytes.Buffer
+	if err := JPG.encode(&b, p, defaultEncoder()); err != nil {
+		t.Fatalf("oriented encode error: %s", err)
+	}
+	m := &metadata{
+		ifd0:        []*ifdEntry{asciiEntry(271, "warhola")},
+		exif:        []*ifdEntry{asciiEntry(36867, "2018:01:01 00:00:00")},
+		xmp:         []byte("<x:xmpmeta/>"),
+		orientation: orientation,
+	}
+	if err := ioutil.WriteFile(path, jpgMetadata(b.Bytes(), p, m), 0660); err != nil {
+		t.Fatalf("oriented write error: %s", err)
+	}
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xA000 && g < 0x6000 && b < 0x6000
+}
+
+func TestMetadata(t *testing.T) {
+	id := "Metadata"
+	for _, v := range []struct {
+		orientation int
+		w, h        int
+		red         image.Point
+	}{
+		{1, 16, 8, image.Pt(1, 1)},
+		{2, 16, 8, image.Pt(14, 1)},
+		{3, 16, 8, image.Pt(14, 6)},
+		{4, 16, 8, image.Pt(1, 6)},
+		{5, 8, 16, image.Pt(1, 1)},
+		{6, 8, 16, image.Pt(6, 1)},
+		{7, 8, 16, image.Pt(6, 14)},
+		{8, 8, 16, image.Pt(1, 14)},
+	} {
+		in, out := "/tmp/test-warhola-orient.jpg", "/tmp/test-warhola-orient-out.jpg"
+		writeOriented(t, in, v.orientation)
+		c, err := New(
+			SetColorModel("RGBA"),
+			SetPath(in, out),
+			SetFileType("jpg"),
+			SetAutoOrient(true),
+			SetKeepMetadata(true),
+		)
+		if err != nil {
+			t.Fatalf("oriented canvas error: %s", err)
+		}
+		b := c.Bounds()
+		if b.Dx() != v.w || b.Dy() != v.h {
+			failProbe(t, id, "orient bounds", commonExpect, image.Pt(v.w, v.h), b.Size())
+		}
+		if !isRed(c.At(v.red.X, v.red.Y)) {
+			failProbe(t, id, "orient", "orientation %d expected red at %v, got %v", v.orientation, v.red, c.At(v.red.X, v.red.Y))
+		}
+		if err = c.Save(); err != nil {
+			t.Fatalf("oriented canvas save error: %s", err)
+		}
+
+		ob, _ := ioutil.ReadFile(out)
+		m := readMetadata(JPG, ob)
+		switch {
+		case m == nil:
+			failProbe(t, id, "passthrough", "expected metadata in saved jpeg")
+		case m.orientation != 1:
+			failProbe(t, id, "passthrough orientation", commonExpect, 1, m.orientation)
+		case findEntry(m.ifd0, 271) == nil, findEntry(m.exif, 36867) == nil:
+			failProbe(t, id, "passthrough", "expected exif entries to be carried")
+		case findEntry(m.exif, tagPixelXDim).uint() != v.w, findEntry(m.exif, tagPixelYDim).uint() != v.h:
+			failProbe(t, id, "passthrough dimensions", "expected pixel dimensions %dx%d", v.w, v.h)
+		case string(m.xmp) != "<x:xmpmeta/>":
+			failProbe(t, id, "passthrough xmp", commonExpect, "<x:xmpmeta/>", string(m.xmp))
+		}
+		os.Remove(in)
+		os.Remove(out)
+	}
+
+	// tiff
+	in, out := "/tmp/test-warhola-orient.jpg", "/tmp/test-warhola-orient-out.tiff"
+	writeOriented(t, in, 6)
+	c, err := New(
+		SetColorModel("RGBA"),
+		SetPath(in, out),
+		SetFileType("jpg"),
+		SetKeepMetadata(true),
+	)
+	if err != nil {
+		t.Fatalf("tiff metadata canvas error: %s", err)
+	}
+	var tb bytes.Buffer
+	if err = TIFF.encode(&tb, c.(*canvas).pxl, c.(*canvas).encoder); err != nil {
+		t.Fatalf("tiff metadata encode error: %s", err)
+	}
+	if _, _, err = image.Decode(bytes.NewReader(tb.Bytes())); err != nil {
+		failProbe(t, id, "tiff", "unable to decode tiff with metadata: %s", err)
+	}
+	m := readMetadata(TIFF, tb.Bytes())
+	switch {
+	case m == nil:
+		failProbe(t, id, "tiff", "expected metadata in encoded tiff")
+	case m.orientation != 6:
+		failProbe(t, id, "tiff orientation", commonExpect, 6, m.orientation)
+	case findEntry(m.ifd0, 271) == nil, findEntry(m.exif, 36867) == nil:
+		failProbe(t, id, "tiff", "expected exif entries to be carried")
+	case findEntry(m.ifd0, tagImageWidth).uint() != 16:
+		failProbe(t, id, "tiff", "expected host image width to be kept")
+	}
+	os.Remove(in)
+}
@@ -1,8 +1,10 @@
 package canvas
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 
 	"github.com/Laughs-In-Flowers/warhola/lib/util/mth"
@@ -14,8 +16,12 @@ import (
 type Operator interface {
 	Adjuster
 	Blender
+	Channeler
 	Convoluter
+	Drawer
+	Flattener
 	Noiser
+	Replacer
 	Transformer
 	Translater
 }
@@ -27,7 +33,7 @@ type Adjuster interface {
 }
 
 func (c *canvas) Adjust(fn AdjustmentFunc) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate("adjust", func() (*pxl, error) {
 		return adjustment(c.pxl, fn)
 	})
 }
@@ -63,6 +69,26 @@ func adjustment(p *pxl, afn AdjustmentFunc) (*pxl, error) {
 	})
 }
 
+// A function drawing in place to the provided image.
+type DrawFunc func(draw.Image) error
+
+type Drawer interface {
+	Draw(string, DrawFunc) error
+}
+
+// Draws with the provided DrawFunc to a copy of the canvas, or of each frame of
+// an animated canvas, restricted to any selection and recorded in any history
+// as the operation op.
+func (c *canvas) Draw(op string, fn DrawFunc) error {
+	return c.mutate(op, func() (*pxl, error) {
+		np := c.pxl.clone(c.pxl.ColorModel())
+		if err := fn(np); err != nil {
+			return nil, err
+		}
+		return np, nil
+	})
+}
+
 type BlendPosition int
 
 const (
@@ -75,12 +101,13 @@ type BlendFunc func(RGBA164, RGBA164) RGBA164
 
 type Blender interface {
 	Blend(image.Image, BlendPosition, BlendFunc) error
+	BlendAt(image.Image, BlendPosition, image.Point, BlendFunc) error
 }
 
 // Blend the provided image with the Canvas, at the provided position using the
 // provided BlendFunc
 func (c *canvas) Blend(i image.Image, pos BlendPosition, fn BlendFunc) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate("blend", func() (*pxl, error) {
 		return blend(c.pxl, i, pos, fn)
 	})
 }
@@ -147,16 +174,56 @@ func blend(p *pxl, i image.Image, pos BlendPosition, bfn BlendFunc) (*pxl, error
 	return dstP, nil
 }
 
+// Blend the provided image with the Canvas at the provided position, where the
+// foreground has its minimum point at the provided point of the background.
+// The result has the bounds of the background, unchanged outside the
+// foreground.
+func (c *canvas) BlendAt(i image.Image, pos BlendPosition, at image.Point, fn BlendFunc) error {
+	return c.mutate(fmt.Sprintf("blend at %v", at), func() (*pxl, error) {
+		return blendAt(c.pxl, i, pos, at, fn)
+	})
+}
+
+func blendAt(p *pxl, i image.Image, pos BlendPosition, at image.Point, bfn BlendFunc) (*pxl, error) {
+	if pos == NoBlendPosition {
+		return p, NoBlendPositionError
+	}
+	np := scratch(p, i.ColorModel(), 0, 0)
+	existingTo(i, np)
+	bg, fg := p, np
+	if pos == BG {
+		bg, fg = np, p
+	}
+	return mutate(p, func() (*pxl, error) {
+		dst := bg.clone(WorkingColorModelFn)
+		composite(dst, fg, at, 100, bfn)
+		return dst, nil
+	})
+}
+
 type Convoluter interface {
 	Convolve(mth.Matrix, float64, bool, bool) error
+	ConvolveSeparable(mth.Matrix, mth.Matrix, float64, bool, bool) error
 }
 
 func (c *canvas) Convolve(m mth.Matrix, bias float64, wrap, keepAlpha bool) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate("convolve", func() (*pxl, error) {
 		return convolve(c.pxl, m, bias, wrap, keepAlpha)
 	})
 }
 
+// Convolves the canvas with the horizontal matrix h and then the vertical
+// matrix v as a single operation, equivalent to convolving with their product.
+func (c *canvas) ConvolveSeparable(h, v mth.Matrix, bias float64, wrap, keepAlpha bool) error {
+	return c.mutate("convolve", func() (*pxl, error) {
+		np, err := convolve(c.pxl, h, bias, wrap, keepAlpha)
+		if err != nil {
+			return nil, err
+		}
+		return convolve(np, v, bias, wrap, keepAlpha)
+	})
+}
+
 func convolve(p *pxl, m mth.Matrix, bias float64, wrap, keepAlpha bool) (*pxl, error) {
 	return mutate(p, func() (*pxl, error) {
 		srcP := p.clone(color.RGBAModel)
@@ -178,7 +245,8 @@ func convolve(p *pxl, m mth.Matrix, bias float64, wrap, keepAlpha bool) (*pxl, e
 		// src bounds now includes padded pixels
 		srcPBounds := srcP.Bounds()
 		srcW, srcH := srcPBounds.Dx(), srcPBounds.Dy()
-		dstP := scratch(srcP, color.RGBAModel, srcW, srcH)
+		// dst bounds exclude the padded pixels
+		dstP := scratch(srcP, color.RGBAModel, srcW-(radiusX*2), srcH-(radiusY*2))
 
 		// To keep alpha we simply don't convolve it
 		switch {
@@ -256,69 +324,75 @@ func convolve(p *pxl, m mth.Matrix, bias float64, wrap, keepAlpha bool) (*pxl, e
 	})
 }
 
-type NoiseFunc func() uint8
-
-type Noiser interface {
-	Noise(NoiseFunc, bool) error
+type Replacer interface {
+	Replace(image.Image) error
 }
 
-func (c *canvas) Noise(fn NoiseFunc, monochrome bool) error {
-	return c.mutate(func() (*pxl, error) {
-		return generateNoise(c.pxl, fn, monochrome)
+// Replaces the pixels of the canvas with those of the provided image, taking
+// its bounds, e.g. with an image produced outside of warhola.
+func (c *canvas) Replace(i image.Image) error {
+	return c.mutate("replace", func() (*pxl, error) {
+		return replace(c.pxl, i)
 	})
 }
 
-func generateNoise(p *pxl, fn NoiseFunc, monochrome bool) (*pxl, error) {
+func replace(p *pxl, i image.Image) (*pxl, error) {
 	return mutate(p, func() (*pxl, error) {
-		if !monochrome {
-			return generateColorNoise(p, fn)
+		np := scratch(p, i.ColorModel(), 0, 0)
+		if _, err := existingTo(i, np); err != nil {
+			return p, err
 		}
-		return generateMonoNoise(p, fn)
+		return np, nil
 	})
 }
 
-func generateColorNoise(p *pxl, nfn NoiseFunc) (*pxl, error) {
-	dstP := p.clone(WorkingColorModelFn)
+// A function providing a noise value in the range of -1 to 1 for the pixel at
+// x, y and the color channel ch (0 red, 1 green, 2 blue). Values depend only on
+// the position, so that noise is reproducible regardless of parallelization.
+type NoiseFunc func(x, y, ch int) float64
 
-	width, height := dstP.Bounds().Dx(), dstP.Bounds().Dy()
+type Noiser interface {
+	Noise(NoiseFunc, float64, bool) error
+}
 
-	prl.Run(height, func(start, end int) {
-		for y := start; y < end; y++ {
-			for x := 0; x < width; x++ {
-				pos := y*dstP.str + x*4
-				dstP.pix[pos+0] = nfn()
-				dstP.pix[pos+1] = nfn()
-				dstP.pix[pos+2] = nfn()
-				dstP.pix[pos+3] = 0xFF
-			}
-		}
+// Applies noise to the canvas, offsetting existing color channels by the
+// provided NoiseFunc at the provided strength (0-1). Monochrome noise uses a
+// single value per pixel for all channels. Alpha is left unchanged.
+func (c *canvas) Noise(fn NoiseFunc, strength float64, monochrome bool) error {
+	return c.mutate("noise", func() (*pxl, error) {
+		return generateNoise(c.pxl, fn, strength, monochrome)
 	})
-	return dstP.clone(p.ColorModel()), nil
 }
 
-func generateMonoNoise(p *pxl, nfn NoiseFunc) (*pxl, error) {
-	dstP := p.clone(WorkingColorModelFn)
+func generateNoise(p *pxl, nfn NoiseFunc, strength float64, monochrome bool) (*pxl, error) {
+	return mutate(p, func() (*pxl, error) {
+		dstP := p.clone(WorkingColorModelFn)
 
-	width, height := dstP.Bounds().Dx(), dstP.Bounds().Dy()
+		width, height := dstP.Bounds().Dx(), dstP.Bounds().Dy()
+		amount := mth.Clamp(strength, 0, 1) * 255
 
-	prl.Run(height, func(start, end int) {
-		for y := start; y < end; y++ {
-			for x := 0; x < width; x++ {
-				pos := y*dstP.str + x*4
-				v := nfn()
-				dstP.pix[pos+0] = v
-				dstP.pix[pos+1] = v
-				dstP.pix[pos+2] = v
-				dstP.pix[pos+3] = 0xFF
+		prl.Run(height, func(start, end int) {
+			for y := start; y < end; y++ {
+				for x := 0; x < width; x++ {
+					pos := y*dstP.str + x*4
+					var n float64
+					for ch := 0; ch < 3; ch++ {
+						if ch == 0 || !monochrome {
+							n = nfn(x, y, ch)
+						}
+						v := float64(dstP.pix[pos+ch]) + n*amount
+						dstP.pix[pos+ch] = uint8(mth.Clamp(v+0.5, 0, 255))
+					}
+				}
 			}
-		}
+		})
+		return dstP.clone(p.ColorModel()), nil
 	})
-
-	return dstP.clone(p.ColorModel()), nil
 }
 
 type Transformer interface {
 	Cropper
+	Extenter
 	Resizer
 }
 
@@ -331,7 +405,7 @@ var EmptyIntersectError = xrr.Xrror("Unable to crop empty intersect of %v and pr
 
 // crops the canvas
 func (c *canvas) Crop(r image.Rectangle) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate(fmt.Sprintf("crop %v", r), func() (*pxl, error) {
 		return crop(c.pxl, r)
 	})
 }
@@ -353,6 +427,51 @@ func crop(p *pxl, r image.Rectangle) (*pxl, error) {
 	}, nil
 }
 
+// An interface for extending or cutting a Canvas to a region.
+type Extenter interface {
+	Extent(image.Rectangle, color.Color) error
+}
+
+// Extent sets the canvas to the provided region of it, which may lie partly
+// or wholly outside the canvas, where any area outside the canvas is filled
+// with the provided color.
+func (c *canvas) Extent(r image.Rectangle, bg color.Color) error {
+	return c.mutate(fmt.Sprintf("extent %v", r), func() (*pxl, error) {
+		return extent(c.pxl, r, bg)
+	})
+}
+
+var EmptyExtentError = xrr.Xrror("Unable to extend to empty region %v").Out
+
+func extent(p *pxl, r image.Rectangle, bg color.Color) (*pxl, error) {
+	if r.Empty() {
+		return p, EmptyExtentError(r)
+	}
+	return mutate(p, func() (*pxl, error) {
+		src := p.clone(WorkingColorModelFn)
+		dst := scratch(p, WorkingColorModelFn, r.Dx(), r.Dy())
+		fill := color.RGBAModel.Convert(bg).(color.RGBA)
+		prl.Run(r.Dy(), func(start, end int) {
+			for y := start; y < end; y++ {
+				for x := 0; x < r.Dx(); x++ {
+					dstPos := y*dst.str + x*4
+					sx, sy := x+r.Min.X, y+r.Min.Y
+					if image.Pt(sx, sy).In(src.rect) {
+						srcPos := sy*src.str + sx*4
+						copy(dst.pix[dstPos:dstPos+4], src.pix[srcPos:srcPos+4])
+						continue
+					}
+					dst.pix[dstPos+0] = fill.R
+					dst.pix[dstPos+1] = fill.G
+					dst.pix[dstPos+2] = fill.B
+					dst.pix[dstPos+3] = fill.A
+				}
+			}
+		})
+		return dst, nil
+	})
+}
+
 type ResampleFilterFunc func(float64) float64
 
 type ResampleFilter struct {
@@ -393,7 +512,7 @@ var ZeroResizeError = xrr.Xrror("zero value prevents resizing\n\twidth %d\n\thei
 
 // resize the canvas
 func (c *canvas) Resize(w, h int, filter ResampleFilter) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate(fmt.Sprintf("resize %dx%d", w, h), func() (*pxl, error) {
 		return resize(c.pxl, w, h, filter)
 	})
 }
@@ -565,7 +684,7 @@ const (
 var NoDirectionError = xrr.Xrror("'%s' is not a direction to flip").Out
 
 func (c *canvas) Flip(dir TDir) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate("flip", func() (*pxl, error) {
 		return flip(c.pxl, dir)
 	})
 }
@@ -615,7 +734,7 @@ func flip(p *pxl, dir TDir) (*pxl, error) {
 }
 
 func (c *canvas) Rotate(angle float64, preserve bool, at image.Point) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate(fmt.Sprintf("rotate %g", angle), func() (*pxl, error) {
 		return rotate(c.pxl, angle, preserve, at)
 	})
 }
@@ -720,7 +839,7 @@ func rotate(p *pxl, angle float64, preserve bool, at image.Point) (*pxl, error)
 }
 
 func (c *canvas) Shear(dir TDir, angle float64) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate(fmt.Sprintf("shear %g", angle), func() (*pxl, error) {
 		return shear(c.pxl, dir, angle)
 	})
 }
@@ -834,7 +953,7 @@ func shear(p *pxl, dir TDir, angle float64) (*pxl, error) {
 }
 
 func (c *canvas) Translate(dx, dy int) error {
-	return c.mutate(func() (*pxl, error) {
+	return c.mutate(fmt.Sprintf("translate %d,%d", dx, dy), func() (*pxl, error) {
 		return translate(c.pxl, dx, dy)
 	})
 }
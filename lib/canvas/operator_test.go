@@ -0,0 +1,79 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPlacement(t *testing.T) {
+	id := "Placement"
+	red, blue, white := color.RGBA{0xFF, 0, 0, 0xFF}, color.RGBA{0, 0, 0xFF, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	newCanvas := func() Canvas {
+		c, err := New(
+			SetColorModel("RGBA"),
+			SetPath("/tmp/test-warhola-placement.png", ""),
+			SetRect(4, 4),
+		)
+		if err != nil {
+			t.Fatalf("placement canvas error: %s", err)
+		}
+		c.Adjust(func(color.RGBA) color.RGBA { return red })
+		return c
+	}
+
+	c := newCanvas()
+	if err := c.Extent(image.Rect(-2, -2, 6, 6), white); err != nil {
+		t.Fatalf("extent error: %s", err)
+	}
+	if got := c.Bounds(); got != image.Rect(0, 0, 8, 8) {
+		failProbe(t, id, "extent bounds", commonExpect, image.Rect(0, 0, 8, 8), got)
+	}
+	if got := rgbaAt(c, 0, 0); got != white {
+		failProbe(t, id, "extent fill", commonExpect, white, got)
+	}
+	if got := rgbaAt(c, 3, 3); got != red {
+		failProbe(t, id, "extent", commonExpect, red, got)
+	}
+	c.Extent(image.Rect(2, 2, 4, 4), white)
+	if got := c.Bounds(); got != image.Rect(0, 0, 2, 2) || rgbaAt(c, 1, 1) != red {
+		failProbe(t, id, "extent cut", "expected a red 2x2 canvas, got %v", got)
+	}
+
+	c = newCanvas()
+	fg := solid(blue, 2, 2)
+	over := func(_, fg RGBA164) RGBA164 { return fg }
+	if err := c.BlendAt(fg, FG, image.Pt(2, 1), over); err != nil {
+		t.Fatalf("blend at error: %s", err)
+	}
+	if got := c.Bounds(); got != image.Rect(0, 0, 4, 4) {
+		failProbe(t, id, "blend at bounds", commonExpect, image.Rect(0, 0, 4, 4), got)
+	}
+	for _, v := range []struct {
+		at   image.Point
+		want color.RGBA
+	}{
+		{image.Pt(2, 1), blue},
+		{image.Pt(3, 2), blue},
+		{image.Pt(1, 1), red},
+		{image.Pt(3, 3), red},
+	} {
+		if got := rgbaAt(c, v.at.X, v.at.Y); got != v.want {
+			failProbe(t, id, "blend at", "at %v "+commonExpect, v.at, v.want, got)
+		}
+	}
+
+	c = newCanvas()
+	c.BlendAt(solid(blue, 6, 6), BG, image.Pt(1, 1), over)
+	if got := c.Bounds(); got != image.Rect(0, 0, 6, 6) || rgbaAt(c, 0, 0) != blue || rgbaAt(c, 1, 1) != red {
+		failProbe(t, id, "blend at background", "unexpected blend onto a background of %v", got)
+	}
+
+	c = newCanvas()
+	if err := c.Replace(solid(blue, 3, 2)); err != nil {
+		t.Fatalf("replace error: %s", err)
+	}
+	if got := c.Bounds(); got != image.Rect(0, 0, 3, 2) || rgbaAt(c, 2, 1) != blue {
+		failProbe(t, id, "replace", "expected a blue 3x2 canvas, got %v", got)
+	}
+}
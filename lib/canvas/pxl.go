@@ -1,9 +1,14 @@
 package canvas
 
 import (
+	"bufio"
+	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
+	"image/gif"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -619,19 +624,93 @@ func OpenTo(path string) (image.Image, error) {
 	return np, nil
 }
 
+// Saves the provided image.Image to the provided path, with a FileType derived
+// from the path extension, defaulting to png.
+func SaveImage(path string, i image.Image) error {
+	t := pathFileType(path)
+	if t == FILETYPENOOP {
+		t = PNG
+	}
+	np := newPxl()
+	np.m = WorkingColorModel
+	if _, err := existingTo(i, np); err != nil {
+		return err
+	}
+	return save(path, t, np, defaultEncoder())
+}
+
 func openTo(path string, p *pxl) (FileType, ColorModel, error) {
-	file, fErr := openFile(path)
-	if fErr != nil {
-		return FILETYPENOOP, COLORNOOP, fErr
+	d, err := openFramesTo(path, p)
+	if err != nil {
+		return FILETYPENOOP, COLORNOOP, err
+	}
+	return d.t, d.cm, nil
+}
+
+// The result of decoding a file to a pxl: the FileType and ColorModel, every
+// frame of an animated gif or nil for any single frame file, and any metadata.
+type decoded struct {
+	t    FileType
+	cm   ColorModel
+	anim *animation
+	meta *metadata
+}
+
+// The path indicating standard input when opening and standard output when
+// saving.
+const PATHSTDIO = "-"
+
+// The reader and writer used for PATHSTDIO.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+)
+
+// openFramesTo opens and decodes the file at path, or standard input, to the
+// provided pxl.
+func openFramesTo(path string, p *pxl) (*decoded, error) {
+	var r io.Reader = stdin
+	if path != PATHSTDIO {
+		file, fErr := openFile(path)
+		if fErr != nil {
+			return nil, fErr
+		}
+		defer file.Close()
+		r = file
+	}
+
+	b, rErr := ioutil.ReadAll(r)
+	if rErr != nil {
+		return nil, rErr
 	}
-	defer file.Close()
+	return decodeTo(b, p)
+}
 
-	i, ext, dErr := image.Decode(file)
+// decodeTo decodes the provided encoded bytes to the provided pxl.
+func decodeTo(b []byte, p *pxl) (*decoded, error) {
+	r := bufio.NewReader(bytes.NewReader(b))
+	if isGif(r) {
+		g, gErr := gif.DecodeAll(r)
+		if gErr != nil {
+			return nil, gErr
+		}
+		a, aErr := decodeAnimation(g, p)
+		if aErr != nil || len(a.frames) < 2 {
+			a = nil
+		}
+		return &decoded{GIF, p.m, a, nil}, aErr
+	}
+
+	i, ext, dErr := image.Decode(r)
 	if dErr != nil {
-		return FILETYPENOOP, COLORNOOP, dErr
+		return nil, dErr
 	}
 	cm, eErr := existingTo(i, p)
-	return stringToFileType(ext), cm, eErr
+	t := stringToFileType(ext)
+	if pp, ppu, ok := readResolution(t, b); ok {
+		p.measure.setResolution(ppu, pp)
+	}
+	return &decoded{t, cm, nil, readMetadata(t, b)}, eErr
 }
 
 func existingTo(in image.Image, p *pxl) (ColorModel, error) {
@@ -739,42 +818,118 @@ func toCorrectedColorModel(in image.Image, p *pxl) image.Image {
 	return out
 }
 
-func save(path string, t FileType, p *pxl) error {
-	f, err := openFile(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	return t.encode(f, p)
+func save(path string, t FileType, p *pxl, e *encoder) error {
+	return writeFile(path, e.backup, func(w io.Writer) error {
+		return t.encode(w, p, e)
+	})
 }
 
-func openFile(path string) (*os.File, error) {
-	p := filepath.Clean(path)
+func saveAnimation(path string, a *animation, e *encoder) error {
+	return writeFile(path, e.backup, func(w io.Writer) error {
+		return encodeGif(w, a)
+	})
+}
 
-	dir, name := filepath.Split(p)
+func absPath(path string) (string, error) {
+	return filepath.Abs(filepath.Clean(path))
+}
 
-	var fp string
-	var aErr error
-	switch dir {
-	case "":
-		fp, aErr = filepath.Abs(name)
-	default:
-		exist(dir)
-		fp, aErr = filepath.Abs(p)
-	}
+func openFile(path string) (*os.File, error) {
+	fp, aErr := absPath(path)
 	if aErr != nil {
 		return nil, aErr
 	}
 
 	var file *os.File
 	var oErr error
-	if file, oErr = os.OpenFile(fp, os.O_RDWR|os.O_CREATE, 0660); oErr != nil {
+	if file, oErr = os.Open(fp); oErr != nil {
 		return nil, openError(fp, path)
 	}
 
 	return file, nil
 }
 
+// writeFile writes to a temporary file in the directory of path with the
+// provided function, syncs it, and renames it over path, so that an existing
+// file at path is replaced whole or not at all. With backup, any existing file
+// is kept as path.bak. PATHSTDIO is written directly to standard output.
+func writeFile(path string, backup bool, fn func(io.Writer) error) error {
+	if path == PATHSTDIO {
+		return fn(stdout)
+	}
+
+	fp, aErr := absPath(path)
+	if aErr != nil {
+		return aErr
+	}
+	dir, name := filepath.Split(fp)
+	exist(dir)
+
+	mode := os.FileMode(0660)
+	if fi, err := os.Stat(fp); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, tErr := ioutil.TempFile(dir, "."+name+".")
+	if tErr != nil {
+		return openError(fp, path)
+	}
+	defer os.Remove(tmp.Name())
+
+	err := fn(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil && backup {
+		err = backupFile(fp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), fp); err != nil {
+		return err
+	}
+	if d, dErr := os.Open(dir); dErr == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupFile keeps any existing file at path as path.bak, by hard link where
+// possible or by copy.
+func backupFile(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	bak := path + ".bak"
+	os.Remove(bak)
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(bak)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
 func exist(path string) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		os.MkdirAll(path, os.ModeDir|0755)
@@ -1 +1,88 @@
 package canvas
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	id := "WriteFile"
+	dir, err := ioutil.TempDir("", "test-warhola-write")
+	if err != nil {
+		t.Fatalf("write file setup error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.png")
+
+	write := func(backup bool, b []byte, fail bool) error {
+		return writeFile(path, backup, func(w io.Writer) error {
+			w.Write(b)
+			if fail {
+				return errors.New("encode failure")
+			}
+			return nil
+		})
+	}
+
+	large, small := bytes.Repeat([]byte("L"), 1024), []byte("small")
+	if err = write(false, large, false); err != nil {
+		failProbe(t, id, "write", "unexpected error %s", err)
+	}
+	if err = write(true, small, false); err != nil {
+		failProbe(t, id, "write", "unexpected error %s", err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, small) {
+		failProbe(t, id, "truncate", commonExpect, small, got)
+	}
+	if got, _ := ioutil.ReadFile(path + ".bak"); !bytes.Equal(got, large) {
+		failProbe(t, id, "backup", "expected backup of the original %d bytes, got %d bytes", len(large), len(got))
+	}
+
+	if err = write(false, large, true); err == nil {
+		failProbe(t, id, "failed write", "expected an error")
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, small) {
+		failProbe(t, id, "failed write", "expected the original file to be untouched, got %d bytes", len(got))
+	}
+
+	fs, _ := ioutil.ReadDir(dir)
+	if len(fs) != 2 {
+		failProbe(t, id, "temporary files", "expected only the file and backup to remain, found %d files", len(fs))
+	}
+}
+
+func TestMemory(t *testing.T) {
+	id := "Memory"
+	i := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	i.Set(1, 1, color.RGBA{255, 0, 0, 255})
+	c, err := FromImage(i)
+	if err != nil {
+		t.Fatalf("memory canvas error: %s", err)
+	}
+	if got := c.Action(); got != ACTIONNEW.String() {
+		failProbe(t, id, "action", commonExpect, ACTIONNEW, got)
+	}
+	if err = c.Save(); err != SaveMemoryError {
+		failProbe(t, id, "save", commonExpect, SaveMemoryError, err)
+	}
+	path := "/tmp/test-warhola-memory.png"
+	defer os.Remove(path)
+	c.SetPath(path)
+	if err = c.Save(); err != nil {
+		failProbe(t, id, "save to path", commonExpect, nil, err)
+	}
+	o, err := New(SetColorModel("RGBA"), SetPath(path, ""))
+	if err != nil {
+		t.Fatalf("open memory canvas error: %s", err)
+	}
+	if got := color.RGBAModel.Convert(o.At(1, 1)); got != (color.RGBA{255, 0, 0, 255}) {
+		failProbe(t, id, "pixel", commonExpect, color.RGBA{255, 0, 0, 255}, got)
+	}
+}
@@ -0,0 +1,154 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+type qColor struct {
+	c     [3]uint8
+	count int
+}
+
+// qLess orders colors by the channel ch, then by the whole color and count, a
+// total order keeping palettes the same from run to run.
+func qLess(a, b qColor, ch int) bool {
+	if a.c[ch] != b.c[ch] {
+		return a.c[ch] < b.c[ch]
+	}
+	for i := 0; i < 3; i++ {
+		if a.c[i] != b.c[i] {
+			return a.c[i] < b.c[i]
+		}
+	}
+	return a.count < b.count
+}
+
+type qBox []qColor
+
+func (b qBox) span() (int, int) {
+	var ch, span int
+	for i := 0; i < 3; i++ {
+		lo, hi := 255, 0
+		for _, c := range b {
+			v := int(c.c[i])
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > span {
+			ch, span = i, hi-lo
+		}
+	}
+	return ch, span
+}
+
+func (b qBox) split() (qBox, qBox) {
+	ch, _ := b.span()
+	sort.SliceStable(b, func(i, j int) bool { return qLess(b[i], b[j], ch) })
+	var total, half int
+	for _, c := range b {
+		total = total + c.count
+	}
+	for i, c := range b {
+		half = half + c.count
+		if half*2 >= total {
+			if i == len(b)-1 {
+				i--
+			}
+			return b[:i+1], b[i+1:]
+		}
+	}
+	return b[:len(b)/2], b[len(b)/2:]
+}
+
+func (b qBox) average() color.Color {
+	var r, g, bl, n int
+	for _, c := range b {
+		r = r + int(c.c[0])*c.count
+		g = g + int(c.c[1])*c.count
+		bl = bl + int(c.c[2])*c.count
+		n = n + c.count
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+}
+
+// medianCut provides a palette of at most n colors from the provided colors by
+// repeatedly splitting the box with the widest channel span at its median.
+func medianCut(colors []qColor, n int) color.Palette {
+	boxes := []qBox{qBox(colors)}
+	for len(boxes) < n {
+		idx, widest := -1, 0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if _, s := b.span(); s > widest {
+				idx, widest = i, s
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		l, r := boxes[idx].split()
+		boxes[idx] = l
+		boxes = append(boxes, r)
+	}
+	var ret color.Palette
+	for _, b := range boxes {
+		ret = append(ret, b.average())
+	}
+	return ret
+}
+
+// quantize reduces the provided pxl to a paletted image of at most n colors
+// using a median cut palette and Floyd-Steinberg dithering. A transparent
+// palette entry is reserved where the pxl contains transparency.
+func quantize(p *pxl, n int) *image.Paletted {
+	srcP := p.clone(color.NRGBAModel)
+	b := srcP.Bounds()
+
+	var transparent bool
+	counts := make(map[[3]uint8]int)
+	for i := 0; i+3 < len(srcP.pix); i = i + 4 {
+		if srcP.pix[i+3] < 128 {
+			transparent = true
+			srcP.pix[i], srcP.pix[i+1], srcP.pix[i+2], srcP.pix[i+3] = 0, 0, 0, 0
+			continue
+		}
+		srcP.pix[i+3] = 255
+		counts[[3]uint8{srcP.pix[i], srcP.pix[i+1], srcP.pix[i+2]}]++
+	}
+
+	if transparent {
+		n = n - 1
+	}
+	colors := make([]qColor, 0, len(counts))
+	for c, count := range counts {
+		colors = append(colors, qColor{c, count})
+	}
+	sort.Slice(colors, func(i, j int) bool { return qLess(colors[i], colors[j], 0) })
+
+	var pal color.Palette
+	switch {
+	case len(colors) == 0:
+	case len(colors) <= n:
+		for _, c := range colors {
+			pal = append(pal, color.RGBA{c.c[0], c.c[1], c.c[2], 255})
+		}
+	default:
+		pal = medianCut(colors, n)
+	}
+	if transparent || len(pal) == 0 {
+		pal = append(pal, color.RGBA{})
+	}
+
+	dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), pal)
+	draw.FloydSteinberg.Draw(dst, dst.Bounds(), srcP, b.Min)
+	return dst
+}
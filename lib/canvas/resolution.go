@@ -0,0 +1,290 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"strings"
+)
+
+// metric reports whether the measure is kept in a metric unit, determining the
+// unit physical resolution is written with.
+func (m *measure) metric() bool {
+	switch strings.ToLower(m.ppu) {
+	case "cm", "centimeter", "mm", "millimeter":
+		return true
+	}
+	return false
+}
+
+// setResolution sets the measure from a resolution read from an existing file.
+func (m *measure) setResolution(ppu string, pp float64) {
+	m.ppu = ppu
+	m.SetPP(ppu, pp)
+}
+
+// writeResolution returns the provided encoded bytes of FileType t with the
+// physical resolution of the provided measure written to them.
+func writeResolution(t FileType, b []byte, m *measure) []byte {
+	if m == nil || m.ppi <= 0 {
+		return b
+	}
+	switch t {
+	case JPG:
+		return jpgResolution(b, m)
+	case PNG:
+		return pngResolution(b, m)
+	case TIFF:
+		return tiffResolution(b, m)
+	}
+	return b
+}
+
+// readResolution returns the points per unit, unit, and whether a physical
+// resolution was found in the provided encoded bytes of FileType t.
+func readResolution(t FileType, b []byte) (float64, string, bool) {
+	switch t {
+	case JPG:
+		return jpgReadResolution(b)
+	case PNG:
+		return pngReadResolution(b)
+	case TIFF:
+		return tiffReadResolution(b)
+	}
+	return 0, "", false
+}
+
+const (
+	jpgSOI  = 0xD8
+	jpgSOS  = 0xDA
+	jpgAPP0 = 0xE0
+)
+
+var jfifIdentifier = []byte("JFIF\x00")
+
+type jpgSegment struct {
+	marker     byte
+	start, end int // start of the marker, end of the segment data
+	data       []byte
+}
+
+// jpgSegments provides the marker segments of a jpeg preceding start of scan.
+func jpgSegments(b []byte) []jpgSegment {
+	var ret []jpgSegment
+	if len(b) < 4 || b[0] != 0xFF || b[1] != jpgSOI {
+		return ret
+	}
+	i := 2
+	for i+4 <= len(b) {
+		if b[i] != 0xFF {
+			break
+		}
+		mk := b[i+1]
+		if mk == 0xFF {
+			i++
+			continue
+		}
+		if mk == jpgSOS {
+			break
+		}
+		l := int(binary.BigEndian.Uint16(b[i+2:]))
+		end := i + 2 + l
+		if l < 2 || end > len(b) {
+			break
+		}
+		ret = append(ret, jpgSegment{mk, i, end, b[i+4 : end]})
+		i = end
+	}
+	return ret
+}
+
+func jfifSegment(units byte, x, y uint16) []byte {
+	s := []byte{0xFF, jpgAPP0, 0, 16}
+	s = append(s, jfifIdentifier...)
+	s = append(s, 1, 2, units, byte(x>>8), byte(x), byte(y>>8), byte(y), 0, 0)
+	return s
+}
+
+// jpgResolution sets the density of an existing JFIF APP0 segment, or inserts
+// one directly after the start of image.
+func jpgResolution(b []byte, m *measure) []byte {
+	units, d := byte(1), m.ppi
+	if m.metric() {
+		units, d = 2, m.ppc
+	}
+	dd := uint16(math.Min(math.Round(d), math.MaxUint16))
+	for _, s := range jpgSegments(b) {
+		if s.marker == jpgAPP0 && len(s.data) >= 12 && bytes.HasPrefix(s.data, jfifIdentifier) {
+			s.data[7] = units
+			binary.BigEndian.PutUint16(s.data[8:], dd)
+			binary.BigEndian.PutUint16(s.data[10:], dd)
+			return b
+		}
+	}
+	if len(b) < 2 {
+		return b
+	}
+	ret := make([]byte, 0, len(b)+18)
+	ret = append(ret, b[:2]...)
+	ret = append(ret, jfifSegment(units, dd, dd)...)
+	return append(ret, b[2:]...)
+}
+
+func jpgReadResolution(b []byte) (float64, string, bool) {
+	for _, s := range jpgSegments(b) {
+		if s.marker == jpgAPP0 && len(s.data) >= 12 && bytes.HasPrefix(s.data, jfifIdentifier) {
+			x := float64(binary.BigEndian.Uint16(s.data[8:]))
+			if x == 0 {
+				return 0, "", false
+			}
+			switch s.data[7] {
+			case 1:
+				return x, "inch", true
+			case 2:
+				return x, "cm", true
+			}
+			return 0, "", false
+		}
+	}
+	return 0, "", false
+}
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ        string
+	start, end int // start of the chunk length, end of the chunk crc
+	data       []byte
+}
+
+// pngChunks provides the chunks of a png up to and including the first IDAT.
+func pngChunks(b []byte) []pngChunk {
+	var ret []pngChunk
+	if !bytes.HasPrefix(b, pngHeader) {
+		return ret
+	}
+	i := len(pngHeader)
+	for i+12 <= len(b) {
+		l := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 12 + l
+		if l < 0 || end > len(b) {
+			break
+		}
+		c := pngChunk{string(b[i+4 : i+8]), i, end, b[i+8 : i+8+l]}
+		ret = append(ret, c)
+		if c.typ == "IDAT" {
+			break
+		}
+		i = end
+	}
+	return ret
+}
+
+func pngChunkBytes(typ string, data []byte) []byte {
+	ret := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(ret, uint32(len(data)))
+	copy(ret[4:], typ)
+	ret = append(ret, data...)
+	crc := crc32.ChecksumIEEE(ret[4:])
+	return append(ret, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// pngResolution replaces or inserts a pHYs chunk, in pixels per meter, after
+// the IHDR chunk.
+func pngResolution(b []byte, m *measure) []byte {
+	ppm := uint32(math.Round(m.ppc * 100))
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint32(data, ppm)
+	binary.BigEndian.PutUint32(data[4:], ppm)
+	data[8] = 1
+	phys := pngChunkBytes("pHYs", data)
+
+	cs := pngChunks(b)
+	if len(cs) == 0 || cs[0].typ != "IHDR" {
+		return b
+	}
+	at, skip := cs[0].end, cs[0].end
+	for _, c := range cs {
+		if c.typ == "pHYs" {
+			at, skip = c.start, c.end
+		}
+	}
+	ret := make([]byte, 0, len(b)+len(phys))
+	ret = append(ret, b[:at]...)
+	ret = append(ret, phys...)
+	return append(ret, b[skip:]...)
+}
+
+// pngReadResolution reads a pHYs chunk, always in pixels per meter, as points
+// per inch where it is within rounding of a whole number of points per inch,
+// as written for an imperial measure, and otherwise as points per cm.
+func pngReadResolution(b []byte) (float64, string, bool) {
+	for _, c := range pngChunks(b) {
+		if c.typ == "pHYs" && len(c.data) == 9 && c.data[8] == 1 {
+			ppm := binary.BigEndian.Uint32(c.data)
+			if ppm == 0 {
+				return 0, "", false
+			}
+			ppi := math.Round(float64(ppm) * 0.0254)
+			if ppi > 0 && uint32(math.Round(ppi/2.54*100)) == ppm {
+				return ppi, "inch", true
+			}
+			return float64(ppm) / 100, "cm", true
+		}
+	}
+	return 0, "", false
+}
+
+const (
+	tiffXResolution    = 282
+	tiffYResolution    = 283
+	tiffResolutionUnit = 296
+	tiffShort          = 3
+	tiffLong           = 4
+	tiffRational       = 5
+)
+
+// tiffResolution overwrites the existing resolution entries of a tiff in place.
+func tiffResolution(b []byte, m *measure) []byte {
+	unit, d := uint16(2), m.ppi
+	if m.metric() {
+		unit, d = 3, m.ppc
+	}
+	bo, es := readIFD0(b)
+	for _, e := range es {
+		switch {
+		case (e.tag == tiffXResolution || e.tag == tiffYResolution) && e.typ == tiffRational && e.count == 1:
+			bo.PutUint32(b[e.at:], uint32(math.Round(d*100)))
+			bo.PutUint32(b[e.at+4:], 100)
+		case e.tag == tiffResolutionUnit && e.typ == tiffShort && e.count == 1:
+			bo.PutUint16(b[e.at:], unit)
+		}
+	}
+	return b
+}
+
+func tiffReadResolution(b []byte) (float64, string, bool) {
+	_, es := readIFD0(b)
+	var x float64
+	if e := findEntry(es, tiffXResolution); e != nil && e.typ == tiffRational && e.count == 1 {
+		num, den := binary.BigEndian.Uint32(e.data), binary.BigEndian.Uint32(e.data[4:])
+		if den != 0 {
+			x = float64(num) / float64(den)
+		}
+	}
+	unit := 2
+	if e := findEntry(es, tiffResolutionUnit); e != nil {
+		unit = e.uint()
+	}
+	if x == 0 {
+		return 0, "", false
+	}
+	switch unit {
+	case 2:
+		return x, "inch", true
+	case 3:
+		return x, "cm", true
+	}
+	return 0, "", false
+}
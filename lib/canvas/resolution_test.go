@@ -0,0 +1,95 @@
+package canvas
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestResolution(t *testing.T) {
+	id := "Resolution"
+	for _, k := range []string{"jpg", "png", "tiff"} {
+		for _, u := range []struct {
+			ppu      string
+			pp, tol  float64
+			inchWant float64
+		}{
+			{"inch", 300, 0.5, 300},
+			{"cm", 40, 0.5, 101.6},
+		} {
+			path := fmt.Sprintf("/tmp/test-warhola-resolution-%s.%s", u.ppu, k)
+			c, err := New(
+				SetColorModel("RGBA"),
+				SetPath(path, ""),
+				SetFileType(k),
+				SetMeasure(u.pp, u.ppu),
+				SetRect(8, 8),
+			)
+			if err != nil {
+				t.Fatalf("new resolution canvas error: %s", err)
+			}
+			if err = c.Save(); err != nil {
+				t.Fatalf("resolution canvas save error: %s", err)
+			}
+
+			o, err := New(
+				SetColorModel("RGBA"),
+				SetPath(path, ""),
+				SetFileType(k),
+				SetMeasure(72, "inch"),
+			)
+			if err != nil {
+				t.Fatalf("open resolution canvas error: %s", err)
+			}
+			if got := o.PP("inch"); math.Abs(got-u.inchWant) > u.tol {
+				failProbe(t, id, k+" "+u.ppu, commonExpect, u.inchWant, got)
+			}
+			os.Remove(path)
+		}
+	}
+}
+
+func TestResolutionRoundTrip(t *testing.T) {
+	id := "ResolutionRoundTrip"
+	in := "/tmp/test-warhola-resolution-round.png"
+	c, err := New(
+		SetColorModel("RGBA"),
+		SetPath(in, ""),
+		SetMeasure(300, "inch"),
+		SetRect(8, 8),
+	)
+	if err != nil {
+		t.Fatalf("new resolution canvas error: %s", err)
+	}
+	if err = c.Save(); err != nil {
+		t.Fatalf("resolution canvas save error: %s", err)
+	}
+	defer os.Remove(in)
+	for _, k := range []string{"jpg", "tiff"} {
+		out := "/tmp/test-warhola-resolution-round." + k
+		c, err := New(
+			SetColorModel("RGBA"),
+			SetPath(in, out),
+			SetMeasure(72, "inch"),
+		)
+		if err != nil {
+			t.Fatalf("open resolution canvas error: %s", err)
+		}
+		if err = c.Save(); err != nil {
+			t.Fatalf("resolution canvas save error: %s", err)
+		}
+		o, err := New(
+			SetColorModel("RGBA"),
+			SetPath(out, ""),
+			SetMeasure(72, "inch"),
+		)
+		if err != nil {
+			t.Fatalf("open resolution canvas error: %s", err)
+		}
+		if got := o.PP("inch"); got != 300 {
+			failProbe(t, id, "png to "+k, commonExpect, 300.0, got)
+		}
+		os.Remove(out)
+	}
+}
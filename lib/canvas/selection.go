@@ -0,0 +1,247 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/util/prl"
+)
+
+// A Selection restricts the operations on a canvas to a region, providing the
+// coverage of the region over the provided bounds as an *image.Alpha where 0
+// is unselected and 0xFF fully selected.
+type Selection interface {
+	Mask(image.Rectangle) *image.Alpha
+}
+
+// A function type satisfying the Selection interface.
+type SelectionFunc func(image.Rectangle) *image.Alpha
+
+// Provides the mask of the SelectionFunc over the provided bounds.
+func (fn SelectionFunc) Mask(r image.Rectangle) *image.Alpha {
+	return fn(r)
+}
+
+// An interface for restricting the operations on a canvas to a Selection.
+type Selector interface {
+	Select(Selection)
+	Selection() Selection
+}
+
+// Restrict all following operations on the canvas to the provided Selection,
+// or to the whole canvas where the Selection is nil. Operations changing the
+// bounds of the canvas are not restricted.
+func (c *canvas) Select(s Selection) {
+	c.sel = s
+}
+
+// The current Selection of the canvas, nil where there is none.
+func (c *canvas) Selection() Selection {
+	return c.sel
+}
+
+// masked provides dst restricted to the canvas selection, where unselected
+// pixels are those of src.
+func (c *canvas) masked(src, dst *pxl) *pxl {
+	if c.sel == nil || !src.Bounds().Eq(dst.Bounds()) {
+		return dst
+	}
+	m := c.sel.Mask(dst.Bounds())
+	s := src.clone(WorkingColorModelFn)
+	d := dst.clone(WorkingColorModelFn)
+	b := d.Bounds()
+	prl.Run(b.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < b.Dx(); x++ {
+				a := float64(m.AlphaAt(b.Min.X+x, b.Min.Y+y).A) / 0xFF
+				if a == 1 {
+					continue
+				}
+				pos := y*d.str + x*4
+				for i := pos; i < pos+4; i++ {
+					d.pix[i] = uint8(float64(s.pix[i]) + (float64(d.pix[i])-float64(s.pix[i]))*a + 0.5)
+				}
+			}
+		}
+	})
+	return d.clone(dst.ColorModel())
+}
+
+func newMask(r image.Rectangle, fn func(x, y int) uint8) *image.Alpha {
+	m := image.NewAlpha(r)
+	prl.Run(r.Dy(), func(start, end int) {
+		for y := r.Min.Y + start; y < r.Min.Y+end; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.Pix[m.PixOffset(x, y)] = fn(x, y)
+			}
+		}
+	})
+	return m
+}
+
+func coverage(in bool) uint8 {
+	if in {
+		return 0xFF
+	}
+	return 0
+}
+
+// A Selection of the pixels within the provided rectangle.
+func RectSelection(sr image.Rectangle) Selection {
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		return newMask(r, func(x, y int) uint8 {
+			return coverage(image.Pt(x, y).In(sr))
+		})
+	})
+}
+
+// A Selection of the pixels within the ellipse bounded by the provided
+// rectangle.
+func EllipseSelection(sr image.Rectangle) Selection {
+	cx, cy := float64(sr.Min.X+sr.Max.X)/2, float64(sr.Min.Y+sr.Max.Y)/2
+	rx, ry := float64(sr.Dx())/2, float64(sr.Dy())/2
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		return newMask(r, func(x, y int) uint8 {
+			if rx == 0 || ry == 0 {
+				return 0
+			}
+			dx, dy := (float64(x)+0.5-cx)/rx, (float64(y)+0.5-cy)/ry
+			return coverage(dx*dx+dy*dy <= 1)
+		})
+	})
+}
+
+// A Selection of the pixels within the polygon of the provided points, by the
+// even-odd rule.
+func PolygonSelection(pts ...image.Point) Selection {
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		return newMask(r, func(x, y int) uint8 {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			in := false
+			for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+				xi, yi := float64(pts[i].X), float64(pts[i].Y)
+				xj, yj := float64(pts[j].X), float64(pts[j].Y)
+				if (yi > py) != (yj > py) && px < (xj-xi)*(py-yi)/(yj-yi)+xi {
+					in = !in
+				}
+			}
+			return coverage(in)
+		})
+	})
+}
+
+// imageMask provides a Selection from the color of each pixel of the image,
+// placed with its minimum point at the origin of the canvas.
+func imageMask(i image.Image, fn func(color.NRGBA) uint8) Selection {
+	ib := i.Bounds()
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		return newMask(r, func(x, y int) uint8 {
+			pt := image.Pt(x, y).Add(ib.Min)
+			if !pt.In(ib) {
+				return 0
+			}
+			return fn(color.NRGBAModel.Convert(i.At(pt.X, pt.Y)).(color.NRGBA))
+		})
+	})
+}
+
+// A Selection by the alpha channel of the provided image.
+func AlphaSelection(i image.Image) Selection {
+	return imageMask(i, func(c color.NRGBA) uint8 {
+		return c.A
+	})
+}
+
+// A Selection by the luminance of the provided image. With a threshold of 0
+// each pixel is selected in proportion to its luminance, otherwise pixels with
+// a luminance greater than or equal to the threshold are fully selected.
+func LuminanceSelection(i image.Image, threshold uint8) Selection {
+	return imageMask(i, func(c color.NRGBA) uint8 {
+		l := Rank(color.RGBA{c.R, c.G, c.B, c.A}) * float64(c.A) / 0xFF
+		if threshold == 0 {
+			return uint8(l + 0.5)
+		}
+		return coverage(uint8(l) >= threshold)
+	})
+}
+
+// A Selection of the pixels not selected by the provided Selection.
+func InvertSelection(s Selection) Selection {
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		m := s.Mask(r)
+		for i := range m.Pix {
+			m.Pix[i] = 0xFF - m.Pix[i]
+		}
+		return m
+	})
+}
+
+// A Selection of the pixels selected by every provided Selection.
+func IntersectSelection(ss ...Selection) Selection {
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		ret := newMask(r, func(x, y int) uint8 { return 0xFF })
+		for _, s := range ss {
+			m := s.Mask(r)
+			for i := range ret.Pix {
+				ret.Pix[i] = uint8(uint32(ret.Pix[i]) * uint32(m.Pix[i]) / 0xFF)
+			}
+		}
+		return ret
+	})
+}
+
+// A Selection softening the edges of the provided Selection with a gaussian
+// falloff over the provided radius.
+func FeatherSelection(s Selection, radius float64) Selection {
+	if radius <= 0 {
+		return s
+	}
+	k := featherKernel(radius)
+	return SelectionFunc(func(r image.Rectangle) *image.Alpha {
+		m := s.Mask(r)
+		h := feather(m, k, 1, 0)
+		return feather(h, k, 0, 1)
+	})
+}
+
+func featherKernel(radius float64) []float64 {
+	n := int(math.Ceil(radius))
+	sigma := radius / 2
+	k := make([]float64, 2*n+1)
+	var sum float64
+	for i := range k {
+		d := float64(i - n)
+		k[i] = math.Exp(-(d * d) / (2 * sigma * sigma))
+		sum += k[i]
+	}
+	for i := range k {
+		k[i] /= sum
+	}
+	return k
+}
+
+// feather convolves the mask with the kernel in the direction dx, dy, extending
+// the edge values of the mask past its bounds.
+func feather(m *image.Alpha, k []float64, dx, dy int) *image.Alpha {
+	r := m.Bounds()
+	n := len(k) / 2
+	clamp := func(v, min, max int) int {
+		switch {
+		case v < min:
+			return min
+		case v >= max:
+			return max - 1
+		}
+		return v
+	}
+	return newMask(r, func(x, y int) uint8 {
+		var v float64
+		for i, w := range k {
+			sx := clamp(x+(i-n)*dx, r.Min.X, r.Max.X)
+			sy := clamp(y+(i-n)*dy, r.Min.Y, r.Max.Y)
+			v += w * float64(m.Pix[m.PixOffset(sx, sy)])
+		}
+		return uint8(math.Min(v+0.5, 0xFF))
+	})
+}
@@ -0,0 +1,120 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/util/mth"
+)
+
+func TestSelection(t *testing.T) {
+	id := "Selection"
+	r := image.Rect(0, 0, 10, 10)
+	in := func(s Selection, pt image.Point) uint8 {
+		return s.Mask(r).AlphaAt(pt.X, pt.Y).A
+	}
+
+	gray := image.NewGray(r)
+	gray.SetGray(2, 2, color.Gray{0xFF})
+	gray.SetGray(3, 3, color.Gray{0x40})
+	alpha := image.NewNRGBA(r)
+	alpha.SetNRGBA(4, 4, color.NRGBA{0, 0, 0, 0xFF})
+
+	for _, v := range []struct {
+		name string
+		s    Selection
+		at   image.Point
+		want uint8
+	}{
+		{"rect in", RectSelection(image.Rect(2, 2, 5, 5)), image.Pt(4, 4), 0xFF},
+		{"rect out", RectSelection(image.Rect(2, 2, 5, 5)), image.Pt(5, 5), 0},
+		{"ellipse center", EllipseSelection(image.Rect(0, 0, 10, 10)), image.Pt(5, 5), 0xFF},
+		{"ellipse corner", EllipseSelection(image.Rect(0, 0, 10, 10)), image.Pt(0, 0), 0},
+		{"polygon in", PolygonSelection(image.Pt(0, 0), image.Pt(10, 0), image.Pt(0, 10)), image.Pt(2, 2), 0xFF},
+		{"polygon out", PolygonSelection(image.Pt(0, 0), image.Pt(10, 0), image.Pt(0, 10)), image.Pt(8, 8), 0},
+		{"luminance", LuminanceSelection(gray, 0), image.Pt(3, 3), 0x40},
+		{"luminance threshold", LuminanceSelection(gray, 0x80), image.Pt(3, 3), 0},
+		{"luminance threshold in", LuminanceSelection(gray, 0x80), image.Pt(2, 2), 0xFF},
+		{"alpha", AlphaSelection(alpha), image.Pt(4, 4), 0xFF},
+		{"alpha out", AlphaSelection(alpha), image.Pt(5, 5), 0},
+		{"invert", InvertSelection(RectSelection(image.Rect(2, 2, 5, 5))), image.Pt(4, 4), 0},
+		{"intersect", IntersectSelection(RectSelection(image.Rect(0, 0, 5, 5)), RectSelection(image.Rect(3, 3, 10, 10))), image.Pt(2, 2), 0},
+	} {
+		if got := in(v.s, v.at); got != v.want {
+			failProbe(t, id, v.name, commonExpect, v.want, got)
+		}
+	}
+
+	f := FeatherSelection(RectSelection(image.Rect(0, 0, 5, 10)), 2)
+	if edge := in(f, image.Pt(4, 5)); edge == 0 || edge == 0xFF {
+		failProbe(t, id, "feather", "expected a soft edge, got %d", edge)
+	}
+	if in(f, image.Pt(0, 5)) != 0xFF || in(f, image.Pt(9, 5)) != 0 {
+		failProbe(t, id, "feather", "expected the feather to be limited to the edge")
+	}
+
+	c, err := New(
+		SetColorModel("RGBA"),
+		SetPath("/tmp/test-warhola-selection.png", ""),
+		SetRect(10, 10),
+	)
+	if err != nil {
+		t.Fatalf("selection canvas error: %s", err)
+	}
+	c.Select(RectSelection(image.Rect(0, 0, 5, 10)))
+	c.Adjust(func(color.RGBA) color.RGBA { return color.RGBA{0xFF, 0, 0, 0xFF} })
+	if got := rgbaAt(c, 2, 2); got.R != 0xFF {
+		failProbe(t, id, "select", "expected the selection adjusted, got %v", got)
+	}
+	if got := rgbaAt(c, 7, 2); got.R != 0 {
+		failProbe(t, id, "select", "expected outside the selection unchanged, got %v", got)
+	}
+	c.Crop(image.Rect(0, 0, 5, 5))
+	if c.Bounds().Dx() != 5 {
+		failProbe(t, id, "crop", commonExpect, 5, c.Bounds().Dx())
+	}
+
+	// a selection is applied once to the result of a whole operation, so a
+	// feathered separable convolution is the full convolution blended by the mask
+	pattern := func() *canvas {
+		c, err := New(SetColorModel("RGBA"), SetPath("/tmp/test-warhola-selection.png", ""), SetRect(10, 10))
+		if err != nil {
+			t.Fatalf("selection canvas error: %s", err)
+		}
+		c.Draw("pattern", func(d draw.Image) error {
+			for y := 0; y < 10; y++ {
+				for x := 0; x < 10; x++ {
+					if (x+2*y)%3 == 0 {
+						d.Set(x, y, color.White)
+					}
+				}
+			}
+			return nil
+		})
+		return c.(*canvas)
+	}
+	k := mth.NewMatrix(5, 1)
+	copy(k.MX, []float64{1, 4, 6, 4, 1})
+	kv := mth.NewMatrix(1, 5)
+	copy(kv.MX, k.MX)
+	h, v := k.Normalized(), kv.Normalized()
+	orig, full, sel := pattern(), pattern(), pattern()
+	full.ConvolveSeparable(h, v, 0, false, false)
+	f = FeatherSelection(RectSelection(image.Rect(0, 0, 5, 10)), 2)
+	sel.Select(f)
+	sel.ConvolveSeparable(h, v, 0, false, false)
+	m := f.Mask(r)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			a := float64(m.AlphaAt(x, y).A) / 0xFF
+			o, fu := float64(rgbaAt(orig, x, y).R), float64(rgbaAt(full, x, y).R)
+			want, got := o+(fu-o)*a, float64(rgbaAt(sel, x, y).R)
+			if math.Abs(want-got) > 1 {
+				failProbe(t, id, "feathered convolve", commonExpect, want, got)
+			}
+		}
+	}
+}
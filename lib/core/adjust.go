@@ -18,6 +18,9 @@ var adjust = NewCommand(
 		for _, a := range adjustments {
 			fs.Float64Vector(v, a.String(), a.key(), a.instruction())
 		}
+		for _, a := range registeredAdjustments() {
+			fs.Float64Vector(v, a.name, fmt.Sprintf("adjust.%s", a.name), a.instruction)
+		}
 		return fs
 	},
 	defaultCommandFunc,
@@ -26,21 +29,32 @@ var adjust = NewCommand(
 
 func adjustStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
 	for _, a := range adjustments {
-		change := o.ToFloat64(a.key())
-		afn := a.fn(change)
-		if afn != nil {
-			t := a.String()
-			cv.Printf("executing %s: %f", t, change)
-			err := cv.Adjust(afn)
-			cv.Printf("adjusted %s...", t)
-			if err != nil {
-				return cv, coreErrorHandler(o, err)
-			}
+		if err := adjustBy(cv, a.String(), o.ToFloat64(a.key()), a.fn); err != nil {
+			return cv, coreErrorHandler(o, err)
+		}
+	}
+	for _, a := range registeredAdjustments() {
+		if err := adjustBy(cv, a.name, o.ToFloat64(fmt.Sprintf("adjust.%s", a.name)), a.fn); err != nil {
+			return cv, coreErrorHandler(o, err)
 		}
 	}
 	return cv, flip.ExitNo
 }
 
+func adjustBy(cv canvas.Canvas, t string, change float64, fn AdjustmentMode) error {
+	if change == 0 {
+		return nil
+	}
+	afn := fn(change)
+	if afn == nil {
+		return nil
+	}
+	cv.Printf("executing %s: %f", t, change)
+	err := cv.Adjust(afn)
+	cv.Printf("adjusted %s...", t)
+	return err
+}
+
 type adjustAction int
 
 const (
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/geo"
 	"github.com/Laughs-In-Flowers/warhola/lib/util/mth"
 	"github.com/Laughs-In-Flowers/xrr"
 )
@@ -135,6 +136,15 @@ func stringToBlend(s string) blendAction {
 	return noblend
 }
 
+// blendMode provides the BlendMode of the core or registered blend of the
+// provided name, and whether one exists.
+func blendMode(s string) (BlendMode, bool) {
+	if b := stringToBlend(s); b != noblend {
+		return b.fn, true
+	}
+	return registeredBlendMode(s)
+}
+
 type (
 	BlendFunc = canvas.BlendFunc
 	RGBA164   = canvas.RGBA164
@@ -392,8 +402,25 @@ func hasFgbgFlag(o *Options) (Position, image.Image, error) {
 	return canvas.NoBlendPosition, nil, extractGroundError
 }
 
-func blendFlag(o *Options, fs *flip.FlagSet, b blendAction) {
-	s := b.String()
+// blendPlacement resolves the gravity and offset of any blend geometry to the
+// point of the foreground on the background.
+func blendPlacement(o *Options, cv canvas.Canvas, pos Position, img image.Image) (image.Point, bool, error) {
+	gs := o.ToString("blend.geometry")
+	if gs == "" {
+		return image.ZP, false, nil
+	}
+	g, err := resolveGeometry(gs, cv)
+	if err != nil {
+		return image.ZP, false, err
+	}
+	fg, bg := img.Bounds(), cv.Bounds()
+	if pos == canvas.BG {
+		fg, bg = bg, fg
+	}
+	return g.Place(fg.Size(), bg.Sub(bg.Min)), true, nil
+}
+
+func blendFlag(o *Options, fs *flip.FlagSet, s string) {
 	fs.BoolVector(o.Vector,
 		s,
 		fmt.Sprintf("blend.%s", s),
@@ -401,8 +428,8 @@ func blendFlag(o *Options, fs *flip.FlagSet, b blendAction) {
 	)
 }
 
-func hasBlendFlag(b blendAction, o *Options) bool {
-	return o.ToBool(fmt.Sprintf("blend.%s", b.String()))
+func hasBlendFlag(s string, o *Options) bool {
+	return o.ToBool(fmt.Sprintf("blend.%s", s))
 }
 
 func optionFlag(o *Options, fs *flip.FlagSet) {
@@ -418,10 +445,11 @@ var blend = NewCommand(
 	func(o *Options) *flip.FlagSet {
 		fs := flip.NewFlagSet("blend", flip.ContinueOnError)
 		fgbgFlag(o, fs)
-		for _, b := range blends {
+		for _, b := range blendNames() {
 			blendFlag(o, fs, b)
 		}
 		optionFlag(o, fs)
+		geo.GeometryVectorFlag(fs, o.Vector, "blend.geometry")
 		return fs
 	},
 	defaultCommandFunc,
@@ -435,10 +463,20 @@ func blendStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
 		return cv, coreErrorHandler(o, pErr)
 	}
 	opt := hasOptionFlag(o)
-	for _, b := range blends {
+	at, placed, gErr := blendPlacement(o, cv, pos, img)
+	if gErr != nil {
+		return cv, coreErrorHandler(o, gErr)
+	}
+	for _, b := range blendNames() {
 		if hasBlendFlag(b, o) {
-			fn := b.fn(opt)
-			bErr := cv.Blend(img, pos, fn)
+			bm, _ := blendMode(b)
+			fn := bm(opt)
+			var bErr error
+			if placed {
+				bErr = cv.BlendAt(img, pos, at, fn)
+			} else {
+				bErr = cv.Blend(img, pos, fn)
+			}
 			if bErr != nil {
 				return cv, coreErrorHandler(o, bErr)
 			}
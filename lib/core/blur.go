@@ -2,10 +2,12 @@ package core
 
 import (
 	"math"
+	"strings"
 
 	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
 	"github.com/Laughs-In-Flowers/warhola/lib/util/mth"
+	"github.com/Laughs-In-Flowers/xrr"
 )
 
 type blurType int
@@ -14,79 +16,151 @@ const (
 	noBlur blurType = iota
 	bBox
 	bGaussian
+	bMotion
 )
 
 var blurs = []blurType{
 	bBox,
 	bGaussian,
+	bMotion,
+}
+
+func (b blurType) String() string {
+	switch b {
+	case bBox:
+		return "box"
+	case bGaussian:
+		return "gaussian"
+	case bMotion:
+		return "motion"
+	}
+	return "noBlur"
+}
+
+func stringToBlurType(s string) blurType {
+	switch strings.ToLower(s) {
+	case "box":
+		return bBox
+	case "gaussian":
+		return bGaussian
+	case "motion":
+		return bMotion
+	}
+	return noBlur
 }
 
 type blurOptions struct {
-	t      blurType
-	radius float64
+	name                 string
+	t                    blurType
+	radius, sigma, angle float64
 }
 
 func optionsToBlurOptions(o *Options) *blurOptions {
-	b := &blurOptions{}
+	name := o.ToString("blur.type")
+	b := &blurOptions{
+		name:   name,
+		t:      stringToBlurType(name),
+		radius: o.ToFloat64("blur.radius"),
+		sigma:  o.ToFloat64("blur.sigma"),
+		angle:  o.ToFloat64("blur.angle"),
+	}
+	switch {
+	case b.radius <= 0 && b.sigma > 0:
+		b.radius = math.Ceil(3 * b.sigma)
+	case b.sigma <= 0 && b.radius > 0:
+		b.sigma = b.radius / 3
+	}
 	return b
 }
 
+var (
+	unknownBlurError = xrr.Xrror("'%s' is not a blur type [box|gaussian|motion]").Out
+	blurRadiusError  = xrr.Xrror("blur radius %g is not greater than 0, set a radius or sigma").Out
+)
+
 func runBlur(cv canvas.Canvas, o *blurOptions) (canvas.Canvas, error) {
+	if o.t == noBlur {
+		return cv, unknownBlurError(o.name)
+	}
+	if o.radius <= 0 {
+		return cv, blurRadiusError(o.radius)
+	}
 	switch o.t {
 	case bBox:
 		return boxBlur(cv, o)
 	case bGaussian:
 		return gaussianBlur(cv, o)
+	case bMotion:
+		return motionBlur(cv, o)
 	}
-	return cv, nil
+	return cv, unknownBlurError(o.name)
+}
+
+// separable applies the provided one dimensional kernel as two passes, first
+// horizontally and then vertically, which is equivalent to convolving with the
+// full two dimensional kernel at a fraction of the cost.
+func separable(cv canvas.Canvas, k []float64) error {
+	length := len(k)
+	h := mth.NewMatrix(length, 1)
+	v := mth.NewMatrix(1, length)
+	copy(h.MX, k)
+	copy(v.MX, k)
+	return cv.ConvolveSeparable(h.Normalized(), v.Normalized(), 0, false, false)
+}
+
+func kernelLength(radius float64) int {
+	return 2*int(math.Ceil(radius)) + 1
 }
 
 func boxBlur(cv canvas.Canvas, o *blurOptions) (canvas.Canvas, error) {
-	radius := o.radius
-	if radius >= 0 {
-		length := int(math.Ceil(2*radius + 1))
-		k := mth.NewMatrix(length, length)
-
-		for x := 0; x < length; x++ {
-			for y := 0; y < length; y++ {
-				k.MX[y*length+x] = 1
-			}
-		}
-
-		err := cv.Convolve(k.Normalized(), 0, false, false)
-		return cv, err
+	length := kernelLength(o.radius)
+	k := make([]float64, length)
+	for i := range k {
+		k[i] = 1
 	}
-	return cv, nil
+	return cv, separable(cv, k)
 }
 
 func gaussianBlur(cv canvas.Canvas, o *blurOptions) (canvas.Canvas, error) {
-	radius := o.radius
-	if radius >= 0 {
-		length := int(math.Ceil(2*radius + 1))
-		k := mth.NewMatrix(length, length)
-
-		gaussianFn := func(x, y, sigma float64) float64 {
-			return math.Exp(-(x*x/sigma + y*y/sigma))
-		}
-
-		for x := 0; x < length; x++ {
-			for y := 0; y < length; y++ {
-				k.MX[y*length+x] = gaussianFn(float64(x)-radius, float64(y)-radius, 4*radius)
-			}
-		}
-
-		err := cv.Convolve(k.Normalized(), 0, false, false)
-		return cv, err
+	length := kernelLength(o.radius)
+	center := float64(length / 2)
+	sigma := math.Max(o.sigma, 0.1)
+	k := make([]float64, length)
+	for i := range k {
+		x := float64(i) - center
+		k[i] = math.Exp(-(x * x) / (2 * sigma * sigma))
 	}
-	return cv, nil
+	return cv, separable(cv, k)
+}
+
+func motionBlur(cv canvas.Canvas, o *blurOptions) (canvas.Canvas, error) {
+	length := kernelLength(o.radius)
+	center := float64(length / 2)
+	k := mth.NewMatrix(length, length)
+
+	rad := o.angle * (math.Pi / 180)
+	dx, dy := math.Cos(rad), -math.Sin(rad)
+	steps := length * 2
+	for i := 0; i <= steps; i++ {
+		t := (float64(i)/float64(steps))*2 - 1
+		x := int(math.Round(center + t*center*dx))
+		y := int(math.Round(center + t*center*dy))
+		k.MX[y*length+x] = 1
+	}
+
+	err := cv.Convolve(k.Normalized(), 0, false, false)
+	return cv, err
 }
 
 var blur = NewCommand(
 	"", "blur", "Apply blur to a canvas", 1,
 	func(o *Options) *flip.FlagSet {
+		v := o.Vector
 		fs := flip.NewFlagSet("blur", flip.ContinueOnError)
-		// bool flag for blurs
-		// radius
+		fs.StringVectorVar(v, "type", "blur.type", "gaussian", "The type of blur to apply. [box|gaussian|motion]")
+		fs.Float64Vector(v, "radius", "blur.radius", "The radius of the blur in pixels, derived from sigma when not provided.")
+		fs.Float64Vector(v, "sigma", "blur.sigma", "The standard deviation of a gaussian blur, derived from radius when not provided.")
+		fs.Float64Vector(v, "angle", "blur.angle", "The angle in degrees of a motion blur.")
 		return fs
 	},
 	defaultCommandFunc,
@@ -94,11 +168,12 @@ var blur = NewCommand(
 ).Command
 
 func blurStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
-	cv.Print("execute blur")
 	bo := optionsToBlurOptions(o)
+	cv.Printf("execute %s blur, radius %f sigma %f", bo.t, bo.radius, bo.sigma)
 	cv, bErr := runBlur(cv, bo)
 	if bErr != nil {
 		return cv, coreErrorHandler(o, bErr)
 	}
+	cv.Print("blurred...")
 	return cv, flip.ExitNo
 }
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+)
+
+var channel = NewCommand(
+	"", "channel", "Extract a single color channel of a canvas to grayscale", 1,
+	func(o *Options) *flip.FlagSet {
+		v := o.Vector
+		fs := flip.NewFlagSet("channel", flip.ContinueOnError)
+		fs.StringVectorVar(v, "channel", "channel.name", "red", "The channel to extract. [red|green|blue|alpha]")
+		return fs
+	},
+	defaultCommandFunc,
+	coreExec(channelStep)...,
+).Command
+
+func channelStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
+	ch := o.ToString("channel.name")
+	cv.Printf("execute channel extraction: %s", ch)
+	if err := cv.ToChannel(ch); err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	cv.Print("extracted...")
+	return cv, flip.ExitNo
+}
@@ -1,15 +1,67 @@
 package core
 
 import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
 	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/mth"
+	"github.com/Laughs-In-Flowers/xrr"
 )
 
+// A named library of commonly used convolution kernels.
+var Kernels = map[string]string{
+	"sharpen":   "0,-1,0;-1,5,-1;0,-1,0",
+	"emboss":    "-2,-1,0;-1,1,1;0,1,2",
+	"edge":      "1,0,-1;0,0,0;-1,0,1",
+	"outline":   "-1,-1,-1;-1,8,-1;-1,-1,-1",
+	"laplacian": "0,-1,0;-1,4,-1;0,-1,0",
+	"sobel-x":   "-1,0,1;-2,0,2;-1,0,1",
+	"sobel-y":   "-1,-2,-1;0,0,0;1,2,1",
+}
+
+func kernelNames() []string {
+	var ret []string
+	for k := range Kernels {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+var noKernelError = xrr.Xrror("no kernel provided, use a named kernel, a matrix string, or a kernel file")
+
+// Provides a matrix from a named kernel, a path to a kernel file, or an inline
+// matrix string, in that order of precedence.
+func StringToKernel(s string) (*mth.M, error) {
+	if s == "" {
+		return nil, noKernelError
+	}
+	if k, ok := Kernels[strings.ToLower(s)]; ok {
+		return mth.StringToMatrix(k)
+	}
+	if fi, err := os.Stat(s); err == nil && !fi.IsDir() {
+		b, err := ioutil.ReadFile(s)
+		if err != nil {
+			return nil, err
+		}
+		return mth.StringToMatrix(string(b))
+	}
+	return mth.StringToMatrix(s)
+}
+
 var convolve = NewCommand(
 	"", "convolve", "Apply a convolution matrice to a canvas", 1,
 	func(o *Options) *flip.FlagSet {
-		//v := o.Vector
+		v := o.Vector
 		fs := flip.NewFlagSet("convolve", flip.ContinueOnError)
+		fs.StringVector(v, "kernel", "convolve.kernel", "A named kernel ["+strings.Join(kernelNames(), "|")+"], a kernel file, or a matrix string e.g. \"0,-1,0;-1,5,-1;0,-1,0\"")
+		fs.Float64Vector(v, "bias", "convolve.bias", "A value added to each color channel after convolution")
+		fs.BoolVector(v, "wrap", "convolve.wrap", "Wrap the image edges instead of extending them")
+		fs.BoolVector(v, "keepAlpha", "convolve.keep.alpha", "Do not convolve the alpha channel")
 		return fs
 	},
 	defaultCommandFunc,
@@ -17,6 +69,17 @@ var convolve = NewCommand(
 ).Command
 
 func convolveStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
-	//cv.Print("execute convolution")
+	k, kErr := StringToKernel(o.ToString("convolve.kernel"))
+	if kErr != nil {
+		return cv, coreErrorHandler(o, kErr)
+	}
+	bias := o.ToFloat64("convolve.bias")
+	wrap, keepAlpha := o.ToBool("convolve.wrap"), o.ToBool("convolve.keep.alpha")
+	cv.Printf("execute convolution:%s", k)
+	err := cv.Convolve(k, bias, wrap, keepAlpha)
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	cv.Print("convolved...")
 	return cv, flip.ExitNo
 }
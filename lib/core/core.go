@@ -61,12 +61,13 @@ func (e executionGroup) sort() { sort.Sort(e) }
 
 func defaultExecutionGroup() executionGroup {
 	ret := make(executionGroup, 0)
-	ret = append(ret, setLogStep, endStep)
+	ret = append(ret, setLogStep, setCtxOptsStep, endStep)
 	return ret
 }
 
 func buildExec(debugKey string, fns ...execution) executionGroup {
 	ret := defaultExecutionGroup()
+	ret = append(ret, selectStep(debugKey))
 	ret = append(ret, fns...)
 	ret = append(ret, debugStep(debugKey))
 	return ret
@@ -86,7 +87,7 @@ func coreMainStep(ie innerExec) executionFn {
 	return func(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
 		cv := ctx.Canvas(c)
 		cv, exit := ie(o, cv)
-		c = context.WithValue(c, 4, cv)
+		c = ctx.WithCanvas(c, cv)
 		return c, exit
 	}
 }
@@ -100,27 +101,28 @@ var (
 		},
 	}
 
-	// Nothing uses this, yet could it be useful (or should it be removed)?
-	//setCtxOptsStep = execution{
-	//	1,
-	//	func(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	//		// 'global' stuff from main in ctx to make 'local'
-	//		return c, flip.ExitNo
-	//	},
-	//}
+	setCtxOptsStep = execution{
+		1,
+		func(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
+			if g := ctx.Geometry(c); g != nil {
+				o.SetString("default.geometry", g.Raw)
+			}
+			return c, flip.ExitNo
+		},
+	}
 
 	debugStep = func(key string) execution {
 		return execution{
 			99,
 			func(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
 				if d := ctx.DebugMap(c); d != nil {
-					ii := CoreOptions.Match(key)
+					ii := o.Match(key)
 					for _, i := range ii {
 						key := i.Key()
 						val := fmt.Sprintf("%v", i.Provided())
 						d[key] = val
 					}
-					c = context.WithValue(c, 1, d)
+					c = ctx.WithDebugMap(c, d)
 				}
 				return c, flip.ExitNo
 			},
@@ -149,12 +151,15 @@ type (
 	cmdFunc func(*command) flip.Command
 )
 
+// The commands made with NewCommand by tag, for running as recipe steps.
+var commands = make(map[string]*command)
+
 func NewCommand(group, tag, instruction string,
 	prio int,
 	ffn flagSetFunc,
 	cfn cmdFunc,
 	x ...execution) *command {
-	return &command{
+	c := &command{
 		group,
 		tag,
 		instruction,
@@ -163,6 +168,8 @@ func NewCommand(group, tag, instruction string,
 		ffn,
 		cfn,
 	}
+	commands[tag] = c
+	return c
 }
 
 func (c *command) executing() executionGroup {
@@ -174,6 +181,7 @@ func (c *command) setExecute(x ...execution) {
 }
 
 func defaultCommandFunc(c *command) flip.Command {
+	o := NewOptions(nil, nil)
 	return flip.NewCommand(
 		c.group,
 		c.tag,
@@ -181,9 +189,9 @@ func defaultCommandFunc(c *command) flip.Command {
 		c.priority,
 		false,
 		func(ctx context.Context, a []string) (context.Context, flip.ExitStatus) {
-			return execute(CoreOptions, ctx, a, c.executing())
+			return execute(o, ctx, a, c.executing())
 		},
-		c.ffn(CoreOptions),
+		selectionFlags(c.tag, o, c.ffn(o)),
 	)
 }
 
@@ -191,13 +199,40 @@ func (c *command) Command() flip.Command {
 	return c.cfn(c)
 }
 
-// A package level Options struct consisting of a logger and a data.Vector.
+// An Options struct consisting of a logger, a data.Vector and the Fonts
+// available to text.
 type Options struct {
 	log.Logger
 	*data.Vector
+	Fonts *Fonts
+}
+
+// Provides new Options with the provided logger and Fonts, where nil Fonts are
+// the core fonts made when first used.
+func NewOptions(l log.Logger, f *Fonts) *Options {
+	return &Options{l, data.New("core_options"), f}
+}
+
+// fresh provides new Options sharing the logger, Fonts and default geometry of
+// these Options.
+func (o *Options) fresh() *Options {
+	n := NewOptions(o.Logger, o.fonts())
+	n.SetString("default.geometry", o.ToString("default.geometry"))
+	return n
 }
 
-func (o *Options) pullGeometry(keys ...string) *geo.Geometry {
+// fonts provides the Fonts of the Options, making the core fonts where none
+// are set.
+func (o *Options) fonts() *Fonts {
+	if o.Fonts == nil {
+		o.Fonts = NewCoreFonts()
+	}
+	return o.Fonts
+}
+
+// pullGeometry parses the first geometry set of the provided keys, or the
+// default geometry, resolving any physical units by the provided Measure.
+func (o *Options) pullGeometry(m canvas.Measure, keys ...string) (*geo.Geometry, error) {
 	var g string = o.ToString("default.geometry")
 	for _, k := range keys {
 		v := o.ToString(k)
@@ -206,7 +241,17 @@ func (o *Options) pullGeometry(keys ...string) *geo.Geometry {
 			break
 		}
 	}
-	return geo.New(g)
+	return resolveGeometry(g, m)
+}
+
+// resolveGeometry parses the geometry string, resolving any physical units by
+// the provided Measure.
+func resolveGeometry(s string, m canvas.Measure) (*geo.Geometry, error) {
+	g, err := geo.Parse(s)
+	if err != nil {
+		return g, err
+	}
+	return g, g.Resolve(m.PP)
 }
 
 func coreErrorHandler(o *Options, err error) flip.ExitStatus {
@@ -217,12 +262,7 @@ func coreErrorHandler(o *Options, err error) flip.ExitStatus {
 	return flip.ExitNo
 }
 
-// A package level Options instance.
-var CoreOptions *Options
-
 func init() {
-	initCoreFonts()
-	CoreOptions = &Options{nil, data.New("core_options")}
 	Core = make(cmdMap)
 	//adjustment
 	Core.Register("adjust", adjust)
@@ -231,15 +271,21 @@ func init() {
 	//blur
 	Core.Register("blur", blur)
 	//channel
-	//BuitIns.Register()
+	Core.Register("channel", channel)
 	//convolute
 	Core.Register("convolve", convolve)
 	//effect
 	//BuiltIns.RegisterFunc()
+	//history
+	Core.Register("history", history)
 	//histogram
-	//BuiltIns.Register()
+	Core.Register("histogram", histogram)
+	//layer
+	Core.Register("layer", layer)
 	//noise
 	Core.Register("noise", noise)
+	//recipe
+	Core.Register("run", run)
 	//text
 	Core.Register("text", text)
 	//transform
@@ -1 +1,416 @@
 package core
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/log"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+)
+
+var recipeYAML = `
+steps:
+  - command: resize
+    options:
+      geometry: 50%
+  - command: adjust
+    options:
+      brightness: 10
+  - command: crop
+    options:
+      geometry: 10x10+2+2
+`
+
+var recipeJSON = `{"steps": [{"command": "resize", "args": ["-geometry", "50%"]}]}`
+
+func TestRecipe(t *testing.T) {
+	for _, v := range []struct {
+		ext, recipe string
+		steps       int
+	}{
+		{".yaml", recipeYAML, 3},
+		{".json", recipeJSON, 1},
+	} {
+		r, err := ParseRecipe([]byte(v.recipe), v.ext)
+		if err != nil {
+			t.Fatalf("%s recipe error: %s", v.ext, err)
+		}
+		if len(r.Steps) != v.steps {
+			t.Errorf("%s recipe: expected %d steps, got %d", v.ext, v.steps, len(r.Steps))
+		}
+		if err := r.Validate(); err != nil {
+			t.Errorf("%s recipe validation error: %s", v.ext, err)
+		}
+	}
+
+	for _, v := range []struct {
+		name, recipe string
+	}{
+		{"no steps", `steps: []`},
+		{"unknown command", "steps:\n  - command: sharpen\n"},
+		{"recursive", "steps:\n  - command: run\n"},
+		{"unknown option", "steps:\n  - command: resize\n    options:\n      size: 50%\n"},
+		{"unusable value", "steps:\n  - command: resize\n    options:\n      geometry: [50, 50]\n"},
+		{"bad value", "steps:\n  - command: adjust\n    options:\n      brightness: bright\n"},
+		{"bad args", "steps:\n  - command: resize\n    args: [-size, 50%]\n"},
+		{"late bad step", recipeYAML + "  - command: blur\n    options:\n      nope: 1\n"},
+	} {
+		r, err := ParseRecipe([]byte(v.recipe), ".yaml")
+		if err != nil {
+			t.Fatalf("%s recipe error: %s", v.name, err)
+		}
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", v.name)
+		}
+	}
+
+	if _, err := ParseRecipe([]byte("stepz: []"), ".yaml"); err == nil {
+		t.Error("expected an error for an unknown recipe key")
+	}
+	if _, err := ParseRecipe([]byte(`{"steps": [{"step": "resize"}]}`), ".json"); err == nil {
+		t.Error("expected an error for an unknown json recipe key")
+	}
+
+	cv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-recipe.png", ""),
+		canvas.SetRect(40, 40),
+	)
+	if err != nil {
+		t.Fatalf("recipe canvas error: %s", err)
+	}
+	r, _ := ParseRecipe([]byte(recipeYAML), ".yaml")
+	l := log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter())
+	c := ctx.With(context.Background(), &ctx.Session{Canvas: cv, Logger: l})
+	c, err = r.Run(c, NewOptions(l, nil))
+	if err != nil {
+		t.Fatalf("recipe run error: %s", err)
+	}
+	if got := ctx.Canvas(c).Bounds(); got != image.Rect(0, 0, 10, 10) {
+		t.Errorf("recipe run: expected %v, got %v", image.Rect(0, 0, 10, 10), got)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	vivid := func(opt float64) BlendFunc {
+		return func(bg, fg RGBA164) RGBA164 {
+			return RGBA164{R: 1 - bg.R, G: fg.G, B: bg.B, A: 1}
+		}
+	}
+	if err := RegisterBlend("vividLight", vivid); err != nil {
+		t.Fatalf("register blend error: %s", err)
+	}
+	if err := RegisterBlend("Multiply", vivid); err == nil {
+		t.Error("expected an error registering a core blend")
+	}
+	if err := RegisterBlend("vividlight", vivid); err == nil {
+		t.Error("expected an error registering an existing blend")
+	}
+	invert := func(change float64) canvas.AdjustmentFunc {
+		return func(c color.RGBA) color.RGBA {
+			return color.RGBA{255 - c.R, 255 - c.G, 255 - c.B, c.A}
+		}
+	}
+	if err := RegisterAdjustment("invert", "Invert the colors of an image, any non zero value", invert); err != nil {
+		t.Fatalf("register adjustment error: %s", err)
+	}
+	if err := RegisterAdjustment("Gamma", "", invert); err == nil {
+		t.Error("expected an error registering a core adjustment")
+	}
+	step := ResampleFilter{Key: "step", Support: 1, Fn: func(x float64) float64 { return 1 }}
+	if err := RegisterResampleFilter(step); err != nil {
+		t.Fatalf("register resample filter error: %s", err)
+	}
+	if err := RegisterResampleFilter(ResampleFilter{Key: "lanczos", Support: 1, Fn: step.Fn}); err == nil {
+		t.Error("expected an error registering a core resample filter")
+	}
+	if stringToFilter("step").Key != "step" {
+		t.Error("registered resample filter is not provided to resize")
+	}
+
+	fg := "/tmp/test-warhola-registry-fg.png"
+	defer os.Remove(fg)
+	fi := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(fi, fi.Rect, image.NewUniform(color.RGBA{0, 200, 0, 255}), image.ZP, draw.Src)
+	if err := canvas.SaveImage(fg, fi); err != nil {
+		t.Fatalf("registry foreground error: %s", err)
+	}
+	r, err := ParseRecipe([]byte(`steps:
+  - command: adjust
+    options:
+      invert: 1
+  - command: blend
+    options:
+      fg: `+fg+`
+      vividLight: true
+  - command: resize
+    options:
+      geometry: 8x8!
+      filter: step
+`), ".yaml")
+	if err != nil {
+		t.Fatalf("registry recipe error: %s", err)
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("registry recipe validation error: %s", err)
+	}
+	cv, _ := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-registry.png", ""),
+		canvas.SetRect(4, 4),
+	)
+	l := log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter())
+	c := ctx.With(context.Background(), &ctx.Session{Canvas: cv, Logger: l})
+	if c, err = r.Run(c, NewOptions(l, nil)); err != nil {
+		t.Fatalf("registry recipe run error: %s", err)
+	}
+	rcv := ctx.Canvas(c)
+	want := color.RGBA{0, 200, 255, 255}
+	if got := color.RGBAModel.Convert(rcv.At(5, 5)).(color.RGBA); rcv.Bounds().Dx() != 8 || got != want {
+		t.Errorf("registry recipe: expected an 8x8 canvas of %v, got %v of %v", want, rcv.Bounds(), got)
+	}
+	if BlendResolver("VIVIDLIGHT") == nil {
+		t.Error("registered blend is not resolved for layers")
+	}
+}
+
+func TestDrawSelection(t *testing.T) {
+	cv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-draw.png", ""),
+		canvas.SetRect(40, 40),
+		canvas.SetHistory(4),
+	)
+	if err != nil {
+		t.Fatalf("draw canvas error: %s", err)
+	}
+	orange := color.RGBA{200, 100, 0, 255}
+	cv.Adjust(func(color.RGBA) color.RGBA { return orange })
+	r, err := ParseRecipe([]byte(`steps:
+  - command: channel
+    args: [-channel, red, -region, 20x40+0+0]
+  - command: text
+    args: [-message, WWWW, -fontSize, "40", -color, FFF, -region, 20x20+0+20]
+`), ".yaml")
+	if err != nil {
+		t.Fatalf("draw recipe error: %s", err)
+	}
+	l := log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter())
+	c := ctx.With(context.Background(), &ctx.Session{Canvas: cv, Logger: l})
+	if c, err = r.Run(c, NewOptions(l, nil)); err != nil {
+		t.Fatalf("draw recipe run error: %s", err)
+	}
+	rcv := ctx.Canvas(c)
+	at := func(x, y int) color.RGBA { return color.RGBAModel.Convert(rcv.At(x, y)).(color.RGBA) }
+	gray, white := color.RGBA{200, 200, 200, 255}, color.RGBA{255, 255, 255, 255}
+	written := func(x0, y0, x1, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				if at(x, y) == white {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case at(15, 5) != gray:
+		t.Errorf("expected the channel within the region, got %v", at(15, 5))
+	case at(35, 35) != orange:
+		t.Errorf("expected no channel outside the region, got %v", at(35, 35))
+	case !written(0, 20, 20, 40):
+		t.Error("expected text within the region")
+	case written(20, 0, 40, 40) || written(0, 0, 20, 20):
+		t.Error("expected no text outside the region")
+	}
+
+	h := rcv.History()
+	if len(h) != 4 || h[3].Operation != "text" {
+		t.Fatalf("expected text recorded in the history, got %v", h)
+	}
+	rcv.Undo()
+	if written(0, 20, 20, 40) || at(5, 35) != gray {
+		t.Errorf("expected undo to remove only the text, got %v", at(5, 35))
+	}
+	rcv.Redo()
+	if !written(0, 20, 20, 40) {
+		t.Error("expected redo to restore the text")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	cv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-histogram.png", canvas.PATHSTDIO),
+		canvas.SetRect(4, 4),
+	)
+	if err != nil {
+		t.Fatalf("histogram canvas error: %s", err)
+	}
+	l := log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter())
+	c := ctx.With(context.Background(), &ctx.Session{Canvas: cv, Logger: l})
+	for _, format := range []string{"image", "csv", "json"} {
+		r, _ := ParseRecipe([]byte("steps:\n  - command: histogram\n    options:\n      format: "+format+"\n"), ".yaml")
+		if _, err := r.Run(c, NewOptions(l, nil)); err == nil {
+			t.Errorf("expected a %s histogram of a canvas written to stdout to require a file", format)
+		}
+	}
+	file := "/tmp/test-warhola-histogram.csv"
+	defer os.Remove(file)
+	r, _ := ParseRecipe([]byte("steps:\n  - command: histogram\n    options:\n      format: csv\n      file: "+file+"\n"), ".yaml")
+	if _, err := r.Run(c, NewOptions(l, nil)); err != nil {
+		t.Errorf("histogram to a file error: %s", err)
+	}
+}
+
+func TestSaltPepper(t *testing.T) {
+	cv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-saltpepper.png", ""),
+		canvas.SetRect(32, 32),
+	)
+	if err != nil {
+		t.Fatalf("salt and pepper canvas error: %s", err)
+	}
+	gray := color.RGBA{100, 150, 200, 255}
+	cv.Adjust(func(color.RGBA) color.RGBA { return gray })
+	r, _ := ParseRecipe([]byte("steps:\n  - command: noise\n    args: [-type, saltpepper, -density, \"0.5\", -amount, \"0.1\", -seed, \"7\"]\n"), ".yaml")
+	l := log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter())
+	c := ctx.With(context.Background(), &ctx.Session{Canvas: cv, Logger: l})
+	if c, err = r.Run(c, NewOptions(l, nil)); err != nil {
+		t.Fatalf("salt and pepper run error: %s", err)
+	}
+	rcv := ctx.Canvas(c)
+	if m := rcv.ColorModel(); m != color.RGBAModel {
+		t.Errorf("expected noise to keep the color model of the canvas, got %v", m)
+	}
+	black, white := color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}
+	seen := make(map[color.RGBA]int)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			px := color.RGBAModel.Convert(rcv.At(x, y)).(color.RGBA)
+			if px != gray && px != black && px != white {
+				t.Fatalf("expected a pixel unchanged, black or white, got %v", px)
+			}
+			seen[px]++
+		}
+	}
+	if seen[black] == 0 || seen[white] == 0 || seen[gray] == 0 {
+		t.Errorf("expected unchanged, black and white pixels, got %v", seen)
+	}
+}
+
+func TestBlur(t *testing.T) {
+	cv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-blur.png", ""),
+		canvas.SetRect(8, 8),
+	)
+	if err != nil {
+		t.Fatalf("blur canvas error: %s", err)
+	}
+	if _, err := runBlur(cv, &blurOptions{name: "Boxy", t: stringToBlurType("Boxy"), radius: 2}); err == nil || !strings.Contains(err.Error(), "'Boxy'") {
+		t.Errorf("expected an error of the provided blur type, got %v", err)
+	}
+	for _, r := range []float64{0, -1} {
+		if _, err := runBlur(cv, &blurOptions{name: "box", t: bBox, radius: r}); err == nil {
+			t.Errorf("expected an error for a blur radius of %g", r)
+		}
+	}
+	if _, err := runBlur(cv, &blurOptions{name: "box", t: bBox, radius: 1}); err != nil {
+		t.Errorf("box blur error: %s", err)
+	}
+
+	hv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-blur.png", ""),
+		canvas.SetRect(8, 8),
+		canvas.SetHistory(4),
+	)
+	if err != nil {
+		t.Fatalf("blur canvas error: %s", err)
+	}
+	hv.Draw("square", func(d draw.Image) error {
+		draw.Draw(d, image.Rect(2, 2, 6, 6), image.NewUniform(color.White), image.ZP, draw.Src)
+		return nil
+	})
+	before := image.NewRGBA(hv.Bounds())
+	draw.Draw(before, before.Rect, hv, image.ZP, draw.Src)
+	if _, err := runBlur(hv, &blurOptions{name: "gaussian", t: bGaussian, radius: 2, sigma: 1}); err != nil {
+		t.Fatalf("gaussian blur error: %s", err)
+	}
+	if h := hv.History(); len(h) != 3 {
+		t.Errorf("expected a blur recorded as a single history state, got %v", h)
+	}
+	hv.Undo()
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if got := color.RGBAModel.Convert(hv.At(x, y)); got != before.At(x, y) {
+				t.Fatalf("expected undo of a blur to restore %v at %d,%d, got %v", before.At(x, y), x, y, got)
+			}
+		}
+	}
+}
+
+func TestLayerPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-warhola-layers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	poster, v2 := filepath.Join(dir, "poster.png"), filepath.Join(dir, "v2.png")
+	cv, err := canvas.New(canvas.SetColorModel("RGBA"), canvas.SetPath(poster, ""), canvas.SetRect(4, 4))
+	if err != nil {
+		t.Fatalf("layer canvas error: %s", err)
+	}
+	cv.Save()
+	l := canvas.NewLayers()
+	ly, _ := canvas.NewLayer("one", image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	l.Add(0, ly)
+	if err = l.Save(poster); err != nil {
+		t.Fatalf("layer save error: %s", err)
+	}
+
+	lg := log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter())
+	r, _ := ParseRecipe([]byte("steps:\n  - command: layer\n    args: [-name, renamed]\n"), ".yaml")
+	run := func(out string) error {
+		cv, err := canvas.New(canvas.SetColorModel("RGBA"), canvas.SetPath(poster, out))
+		if err != nil {
+			t.Fatalf("layer canvas error: %s", err)
+		}
+		_, err = r.Run(ctx.With(context.Background(), &ctx.Session{Canvas: cv, Logger: lg}), NewOptions(lg, nil))
+		return err
+	}
+
+	if err = run(v2); err != nil {
+		t.Fatalf("layer run error: %s", err)
+	}
+	got, err := canvas.OpenLayers(v2)
+	if err != nil || got.Len() != 1 {
+		t.Fatalf("expected the layers of the in file written alongside the out file, got %v %v", got, err)
+	}
+	if ly, _ := got.Get(0); ly.Name != "renamed" {
+		t.Errorf("expected the layer renamed, got %s", ly.Name)
+	}
+	if in, _ := canvas.OpenLayers(poster); in.Len() != 1 {
+		t.Error("expected the layers of the in file kept")
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	if err = run(canvas.PATHSTDIO); err == nil {
+		t.Error("expected an error keeping layers of a canvas written to stdout")
+	}
+	if _, err = os.Stat(canvas.LayersPath(canvas.PATHSTDIO)); !os.IsNotExist(err) {
+		t.Errorf("expected no layers file for stdout, got %v", err)
+	}
+}
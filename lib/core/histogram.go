@@ -0,0 +1,122 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+var histogram = NewCommand(
+	"", "histogram", "Write the RGBA histogram of a canvas as an image, csv or json", 1,
+	func(o *Options) *flip.FlagSet {
+		v := o.Vector
+		fs := flip.NewFlagSet("histogram", flip.ContinueOnError)
+		fs.StringVectorVar(v, "format", "histogram.format", "image", "The histogram output format. [image|csv|json]")
+		fs.StringVector(v, "file", "histogram.file", "The histogram output file, defaulting to <name>.histogram.png for images and stdout otherwise. Required where the canvas is written to stdout")
+		fs.BoolVector(v, "cumulative", "histogram.cumulative", "Write a cumulative histogram")
+		return fs
+	},
+	defaultCommandFunc,
+	coreExec(histogramStep)...,
+).Command
+
+var (
+	unknownHistogramFormatError = xrr.Xrror("'%s' is not a histogram format [image|csv|json]").Out
+	histogramFileError          = xrr.Xrror("the canvas is written to stdout, set -file to write the histogram")
+)
+
+func histogramStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
+	format := strings.ToLower(o.ToString("histogram.format"))
+	file := o.ToString("histogram.file")
+	cv.Printf("execute %s histogram", format)
+	if file == "" && cv.Path() == canvas.PATHSTDIO {
+		return cv, coreErrorHandler(o, histogramFileError)
+	}
+
+	h := cv.RGBAHistogram()
+	if o.ToBool("histogram.cumulative") {
+		h = h.Cumulative()
+	}
+
+	var err error
+	switch format {
+	case "image", "":
+		if file == "" {
+			file = histogramPath(cv.Path())
+		}
+		err = canvas.SaveImage(file, h.Image())
+	case "csv":
+		err = writeHistogram(file, h, histogramCSV)
+	case "json":
+		err = writeHistogram(file, h, histogramJSON)
+	default:
+		err = unknownHistogramFormatError(format)
+	}
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	cv.Printf("histogram written to %s", histogramDest(file))
+	return cv, flip.ExitNo
+}
+
+func histogramPath(p string) string {
+	ext := filepath.Ext(p)
+	return fmt.Sprintf("%s.histogram.png", strings.TrimSuffix(p, ext))
+}
+
+func histogramDest(file string) string {
+	if file == "" {
+		return "stdout"
+	}
+	return file
+}
+
+type histogramWriter func(io.Writer, *canvas.RGBAHistogram) error
+
+func writeHistogram(file string, h *canvas.RGBAHistogram, fn histogramWriter) error {
+	if file == "" {
+		return fn(os.Stdout, h)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return fn(f, h)
+}
+
+func histogramCSV(w io.Writer, h *canvas.RGBAHistogram) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"bin", "red", "green", "blue", "alpha"})
+	for i := range h.R.Bins {
+		cw.Write([]string{
+			strconv.Itoa(i),
+			strconv.Itoa(h.R.Bins[i]),
+			strconv.Itoa(h.G.Bins[i]),
+			strconv.Itoa(h.B.Bins[i]),
+			strconv.Itoa(h.A.Bins[i]),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func histogramJSON(w io.Writer, h *canvas.RGBAHistogram) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string][]int{
+		"red":   h.R.Bins,
+		"green": h.G.Bins,
+		"blue":  h.B.Bins,
+		"alpha": h.A.Bins,
+	})
+}
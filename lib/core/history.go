@@ -0,0 +1,44 @@
+package core
+
+import (
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+)
+
+var history = NewCommand(
+	"", "history", "Undo, redo or list the operations on a canvas kept with the -history option", 1,
+	func(o *Options) *flip.FlagSet {
+		v := o.Vector
+		fs := flip.NewFlagSet("history", flip.ContinueOnError)
+		fs.IntVector(v, "undo", "history.undo", "Undo the last n operations")
+		fs.IntVector(v, "redo", "history.redo", "Redo the last n undone operations")
+		fs.BoolVector(v, "list", "history.list", "List the operations held in the history")
+		return fs
+	},
+	defaultCommandFunc,
+	coreExec(historyStep)...,
+).Command
+
+func historyStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
+	cv.Print("execute history")
+	for i := 0; i < o.ToInt("history.undo"); i++ {
+		if err := cv.Undo(); err != nil {
+			return cv, coreErrorHandler(o, err)
+		}
+	}
+	for i := 0; i < o.ToInt("history.redo"); i++ {
+		if err := cv.Redo(); err != nil {
+			return cv, coreErrorHandler(o, err)
+		}
+	}
+	if o.ToBool("history.list") {
+		for i, s := range cv.History() {
+			mark := " "
+			if s.Current {
+				mark = "*"
+			}
+			cv.Printf("%s %d %s %v", mark, i, s.Operation, s.Image.Bounds().Size())
+		}
+	}
+	return cv, flip.ExitNo
+}
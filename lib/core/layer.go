@@ -0,0 +1,207 @@
+package core
+
+import (
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+var layer = NewCommand(
+	"", "layer", "Add, edit, reorder and merge layers kept alongside a canvas in a .layers file", 1,
+	func(o *Options) *flip.FlagSet {
+		v := o.Vector
+		fs := flip.NewFlagSet("layer", flip.ContinueOnError)
+		fs.StringVector(v, "add", "layer.add", "An image to add as a new layer")
+		fs.StringVectorVar(v, "index", "layer.index", "top", "The layer acted on, from 0 at the bottom, or top. [n|top]")
+		fs.StringVector(v, "name", "layer.name", "Set the name of the layer")
+		fs.StringVector(v, "offset", "layer.offset", "Set the offset of the layer over the canvas as x,y")
+		fs.Float64VectorVar(v, "opacity", "layer.opacity", -1, "Set the opacity of the layer. [0-100]")
+		fs.StringVector(v, "mode", "layer.mode", "Set the blend mode of the layer ["+strings.Join(blendNames(), "|")+"]")
+		fs.BoolVector(v, "hide", "layer.hide", "Hide the layer")
+		fs.BoolVector(v, "show", "layer.show", "Show the layer")
+		fs.StringVector(v, "move", "layer.move", "Move the layer to another index. [n|top]")
+		fs.BoolVector(v, "remove", "layer.remove", "Remove the layer")
+		fs.BoolVector(v, "merge", "layer.merge", "Merge the layer down onto the layer below it")
+		fs.BoolVector(v, "flatten", "layer.flatten", "Composite all visible layers onto the canvas and remove the layers")
+		fs.BoolVector(v, "list", "layer.list", "List the layers")
+		return fs
+	},
+	defaultCommandFunc,
+	coreExec(layerStep)...,
+).Command
+
+func blendNames() []string {
+	var ret []string
+	for _, b := range blends {
+		ret = append(ret, b.String())
+	}
+	return append(ret, registeredBlendNames()...)
+}
+
+// The BlendResolver of all core and registered blend modes.
+func BlendResolver(mode string) canvas.BlendFunc {
+	if bm, ok := blendMode(mode); ok {
+		return bm(0)
+	}
+	return noblend.fn(0)
+}
+
+var (
+	layerIndexError  = xrr.Xrror("'%s' is not a layer index [n|top]").Out
+	layerOffsetError = xrr.Xrror("'%s' is not a layer offset x,y").Out
+	layerModeError   = xrr.Xrror("'%s' is not a blend mode").Out
+	layerPathError   = xrr.Xrror("layers are kept in a file alongside the canvas, unavailable for path '%s'").Out
+)
+
+// layerPaths provides the path the layers of the canvas are read from, that
+// of its in file, and the path they are written to, that of its out file.
+func layerPaths(cv canvas.Canvas) (string, string, error) {
+	in, out := cv.InPath(), cv.Path()
+	for _, p := range []string{in, out} {
+		if p == canvas.PATHSTDIO || p == "" {
+			return in, out, layerPathError(p)
+		}
+	}
+	return in, out, nil
+}
+
+func layerIndex(s string, l *canvas.Layers) (int, error) {
+	if s == "" || strings.ToLower(s) == "top" {
+		return l.Len() - 1, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, layerIndexError(s)
+	}
+	return i, nil
+}
+
+func layerOffset(s string) (image.Point, error) {
+	spl := strings.Split(s, ",")
+	if len(spl) != 2 {
+		return image.ZP, layerOffsetError(s)
+	}
+	x, xErr := strconv.Atoi(strings.TrimSpace(spl[0]))
+	y, yErr := strconv.Atoi(strings.TrimSpace(spl[1]))
+	if xErr != nil || yErr != nil {
+		return image.ZP, layerOffsetError(s)
+	}
+	return image.Point{x, y}, nil
+}
+
+// layerEdit sets any provided layer properties on the layer.
+func layerEdit(o *Options, ly *canvas.Layer) error {
+	if n := o.ToString("layer.name"); n != "" {
+		ly.Name = n
+	}
+	if s := o.ToString("layer.offset"); s != "" {
+		pt, err := layerOffset(s)
+		if err != nil {
+			return err
+		}
+		ly.Offset = pt
+	}
+	if op := o.ToFloat64("layer.opacity"); op >= 0 {
+		ly.Opacity = op
+	}
+	if m := o.ToString("layer.mode"); m != "" {
+		if _, ok := blendMode(m); !ok {
+			return layerModeError(m)
+		}
+		ly.Mode = m
+	}
+	switch {
+	case o.ToBool("layer.hide"):
+		ly.Visible = false
+	case o.ToBool("layer.show"):
+		ly.Visible = true
+	}
+	return nil
+}
+
+func layerStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
+	cv.Print("execute layer")
+	in, out, err := layerPaths(cv)
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	l, err := canvas.OpenLayers(in)
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	if err = layerActions(o, cv, l); err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	if o.ToBool("layer.list") {
+		for i := 0; i < l.Len(); i++ {
+			ly, _ := l.Get(i)
+			cv.Printf("layer %d %s: offset %v, opacity %v, mode %s, visible %t",
+				i, ly.Name, ly.Offset, ly.Opacity, ly.Mode, ly.Visible)
+		}
+	}
+	return cv, coreErrorHandler(o, l.Save(out))
+}
+
+func layerActions(o *Options, cv canvas.Canvas, l *canvas.Layers) error {
+	if o.ToBool("layer.flatten") {
+		if err := cv.Flatten(l, BlendResolver); err != nil {
+			return err
+		}
+		*l = *canvas.NewLayers()
+		cv.Print("layers flattened")
+		return nil
+	}
+
+	if add := o.ToString("layer.add"); add != "" {
+		i, err := canvas.OpenTo(add)
+		if err != nil {
+			return err
+		}
+		ly, err := canvas.NewLayer(add, i)
+		if err != nil {
+			return err
+		}
+		at := l.Len()
+		if s := o.ToString("layer.index"); strings.ToLower(s) != "top" {
+			if at, err = layerIndex(s, l); err != nil {
+				return err
+			}
+		}
+		l.Add(at, ly)
+		cv.Printf("layer %s added", add)
+		return layerEdit(o, ly)
+	}
+
+	if l.Len() == 0 {
+		return nil
+	}
+	idx, err := layerIndex(o.ToString("layer.index"), l)
+	if err != nil {
+		return err
+	}
+	switch {
+	case o.ToBool("layer.remove"):
+		return l.Remove(idx)
+	case o.ToBool("layer.merge"):
+		return l.Merge(idx, BlendResolver)
+	}
+	ly, err := l.Get(idx)
+	if err != nil {
+		return err
+	}
+	if err = layerEdit(o, ly); err != nil {
+		return err
+	}
+	if mv := o.ToString("layer.move"); mv != "" {
+		to, err := layerIndex(mv, l)
+		if err != nil {
+			return err
+		}
+		return l.Move(idx, to)
+	}
+	return nil
+}
@@ -1,15 +1,216 @@
 package core
 
 import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
 	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/xrr"
 )
 
+type noiseType int
+
+const (
+	noNoise noiseType = iota
+	nUniform
+	nGaussian
+	nSaltPepper
+	nPerlin
+)
+
+func (n noiseType) String() string {
+	switch n {
+	case nUniform:
+		return "uniform"
+	case nGaussian:
+		return "gaussian"
+	case nSaltPepper:
+		return "saltpepper"
+	case nPerlin:
+		return "perlin"
+	}
+	return "noNoise"
+}
+
+func stringToNoiseType(s string) noiseType {
+	switch strings.ToLower(s) {
+	case "uniform":
+		return nUniform
+	case "gaussian":
+		return nGaussian
+	case "saltpepper", "salt-pepper", "saltandpepper":
+		return nSaltPepper
+	case "perlin":
+		return nPerlin
+	}
+	return noNoise
+}
+
+type noiseOptions struct {
+	t                      noiseType
+	amount, density, scale float64
+	seed                   int64
+	mono                   bool
+}
+
+func optionsToNoiseOptions(o *Options) *noiseOptions {
+	n := &noiseOptions{
+		t:       stringToNoiseType(o.ToString("noise.type")),
+		amount:  o.ToFloat64("noise.amount"),
+		density: o.ToFloat64("noise.density"),
+		scale:   o.ToFloat64("noise.scale"),
+		seed:    int64(o.ToInt("noise.seed")),
+		mono:    o.ToBool("noise.mono"),
+	}
+	if n.seed == 0 {
+		n.seed = time.Now().UnixNano()
+	}
+	return n
+}
+
+var unknownNoiseError = xrr.Xrror("'%s' is not a noise type [uniform|gaussian|saltpepper|perlin]").Out
+
+func (n *noiseOptions) fn() (canvas.NoiseFunc, error) {
+	seed := uint64(n.seed)
+	switch n.t {
+	case nUniform:
+		return func(x, y, ch int) float64 {
+			return hashUnit(seed, x, y, ch)*2 - 1
+		}, nil
+	case nGaussian:
+		return func(x, y, ch int) float64 {
+			// Box-Muller transform of two position dependent uniform values
+			u1 := math.Max(hashUnit(seed, x, y, ch), 1e-12)
+			u2 := hashUnit(seed^0x9e3779b97f4a7c15, x, y, ch)
+			return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+		}, nil
+	case nSaltPepper:
+		// a value of -1 or 1 at full strength sets a pixel to black or white
+		density := n.density
+		return func(x, y, ch int) float64 {
+			if hashUnit(seed, x, y, 0) >= density {
+				return 0
+			}
+			if hashUnit(seed^0x9e3779b97f4a7c15, x, y, 0) < 0.5 {
+				return -1
+			}
+			return 1
+		}, nil
+	case nPerlin:
+		p := newPerlin(n.seed)
+		scale := n.scale
+		if scale <= 0 {
+			scale = 0.05
+		}
+		return func(x, y, ch int) float64 {
+			// offset each channel to sample an unrelated region of the noise plane
+			o := float64(ch) * 1013.0
+			return p.noise(float64(x)*scale+o, float64(y)*scale+o)
+		}, nil
+	}
+	return nil, unknownNoiseError(n.t)
+}
+
+// strength provides the strength noise is applied at, in full for saltpepper
+// noise, where chosen pixels are set to white or black.
+func (n *noiseOptions) strength() float64 {
+	if n.t == nSaltPepper {
+		return 1
+	}
+	return n.amount
+}
+
+// hashUnit provides a deterministic value in the range [0, 1) for the provided
+// seed, position and channel.
+func hashUnit(seed uint64, x, y, ch int) float64 {
+	h := seed
+	h ^= uint64(uint32(x)) * 0xbf58476d1ce4e5b9
+	h ^= uint64(uint32(y)) * 0x94d049bb133111eb
+	h ^= uint64(ch+1) * 0x9e3779b97f4a7c15
+	// splitmix64 finalizer
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return float64(h>>11) / float64(1<<53)
+}
+
+type perlin struct {
+	p [512]int
+}
+
+func newPerlin(seed int64) *perlin {
+	r := rand.New(rand.NewSource(seed))
+	perm := r.Perm(256)
+	ret := &perlin{}
+	for i := 0; i < 512; i++ {
+		ret.p[i] = perm[i&255]
+	}
+	return ret
+}
+
+func perlinFade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func perlinLerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+func perlinGrad(hash int, x, y float64) float64 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	}
+	return -y
+}
+
+// noise provides two dimensional gradient noise in the range of -1 to 1.
+func (p *perlin) noise(x, y float64) float64 {
+	fx, fy := math.Floor(x), math.Floor(y)
+	xi, yi := int(fx)&255, int(fy)&255
+	x, y = x-fx, y-fy
+	u, v := perlinFade(x), perlinFade(y)
+
+	aa := p.p[p.p[xi]+yi]
+	ab := p.p[p.p[xi]+yi+1]
+	ba := p.p[p.p[xi+1]+yi]
+	bb := p.p[p.p[xi+1]+yi+1]
+
+	n := perlinLerp(v,
+		perlinLerp(u, perlinGrad(aa, x, y), perlinGrad(ba, x-1, y)),
+		perlinLerp(u, perlinGrad(ab, x, y-1), perlinGrad(bb, x-1, y-1)),
+	)
+	return math.Max(math.Min(n, 1), -1)
+}
+
 var noise = NewCommand(
 	"", "noise", "Apply noise to a canvas", 1,
 	func(o *Options) *flip.FlagSet {
-		//v := o.Vector
+		v := o.Vector
 		fs := flip.NewFlagSet("noise", flip.ContinueOnError)
+		fs.StringVectorVar(v, "type", "noise.type", "uniform", "The type of noise to generate. [uniform|gaussian|saltpepper|perlin]")
+		fs.Float64VectorVar(v, "amount", "noise.amount", 0.1, "The strength of the noise blended onto the canvas, 0 to 1, saltpepper noise is always at full strength")
+		fs.Float64VectorVar(v, "density", "noise.density", 0.05, "The fraction of pixels set to white or black by saltpepper noise, 0 to 1")
+		fs.Float64VectorVar(v, "scale", "noise.scale", 0.05, "The frequency of perlin noise, smaller values are smoother")
+		fs.IntVector(v, "seed", "noise.seed", "A seed for reproducible noise, 0 or unset for a random seed")
+		fs.BoolVector(v, "mono", "noise.mono", "Generate monochrome noise")
 		return fs
 	},
 	defaultCommandFunc,
@@ -17,6 +218,16 @@ var noise = NewCommand(
 ).Command
 
 func noiseStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
-	//cv.Print("execute noise")
+	no := optionsToNoiseOptions(o)
+	fn, err := no.fn()
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	cv.Printf("execute %s noise, amount %f seed %d", no.t, no.amount, no.seed)
+	err = cv.Noise(fn, no.strength(), no.mono)
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	cv.Print("noised...")
 	return cv, flip.ExitNo
 }
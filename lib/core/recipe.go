@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/xrr"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var run = NewCommand(
+	"", "run", "Run the steps of a JSON or YAML recipe in order against the canvas", 1,
+	func(o *Options) *flip.FlagSet {
+		v := o.Vector
+		fs := flip.NewFlagSet("run", flip.ContinueOnError)
+		fs.StringVector(v, "recipe", "run.recipe", "The path of the recipe to run")
+		return fs
+	},
+	func(c *command) flip.Command {
+		o := NewOptions(nil, nil)
+		return flip.NewCommand(
+			c.group,
+			c.tag,
+			c.instruction,
+			c.priority,
+			false,
+			func(ctx context.Context, a []string) (context.Context, flip.ExitStatus) {
+				return execute(o, ctx, a, c.executing())
+			},
+			c.ffn(o),
+		)
+	},
+	execution{50, runStep},
+).Command
+
+func runStep(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
+	r, err := ReadRecipe(o.ToString("run.recipe"))
+	if err == nil {
+		err = r.Validate()
+	}
+	if err == nil {
+		c, err = r.Run(c, o)
+	}
+	return c, coreErrorHandler(o, err)
+}
+
+// A Recipe is a list of core command steps run in order against one canvas.
+type Recipe struct {
+	Steps []Step `json:"steps" yaml:"steps"`
+}
+
+// A Step of a Recipe, naming a core command and its options by flag name, or
+// its flags as they would be given on the command line.
+type Step struct {
+	Command string                 `json:"command" yaml:"command"`
+	Options map[string]interface{} `json:"options" yaml:"options"`
+	Args    []string               `json:"args" yaml:"args"`
+}
+
+var (
+	recipeFormatError  = xrr.Xrror("unable to read recipe %s: %s").Out
+	recipeEmptyError   = xrr.Xrror("recipe has no steps")
+	recipeCommandError = xrr.Xrror("step %d: '%s' is not a core command").Out
+	recipeOptionError  = xrr.Xrror("step %d: '%s' is not an option of %s").Out
+	recipeValueError   = xrr.Xrror("step %d: %s option %s has an unusable value %v").Out
+	recipeParseError   = xrr.Xrror("step %d: %s: %s").Out
+	recipeStepError    = xrr.Xrror("step %d: %s failed").Out
+)
+
+// Read the recipe at the provided path, decoding JSON where the path has a
+// .json extension and YAML otherwise.
+func ReadRecipe(path string) (*Recipe, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRecipe(b, filepath.Ext(path))
+}
+
+// Parse a recipe from the provided bytes, as JSON for a .json extension and
+// YAML for any other, returning an error for any unknown key in either.
+func ParseRecipe(b []byte, ext string) (*Recipe, error) {
+	r := &Recipe{}
+	var err error
+	switch strings.ToLower(ext) {
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		err = d.Decode(r)
+	default:
+		err = yaml.UnmarshalStrict(b, r)
+	}
+	if err != nil {
+		return nil, recipeFormatError(ext, err)
+	}
+	return r, nil
+}
+
+// Validate every step of the recipe ahead of running any, returning an error
+// for an unknown command, an unknown option or an option value its flag does
+// not accept.
+func (r *Recipe) Validate() error {
+	if len(r.Steps) == 0 {
+		return recipeEmptyError
+	}
+	for i, s := range r.Steps {
+		if _, _, err := s.parse(i, NewOptions(nil, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run the steps of the recipe in order against the canvas of the provided
+// context, each with fresh Options sharing the logger, Fonts and default
+// geometry of the provided Options, stopping at the first step that fails.
+func (r *Recipe) Run(c context.Context, o *Options) (context.Context, error) {
+	for i, s := range r.Steps {
+		so := o.fresh()
+		cmd, a, err := s.parse(i, so)
+		if err != nil {
+			return c, err
+		}
+		var status flip.ExitStatus
+		c, status = execute(so, c, a, cmd.executing())
+		if status != flip.ExitSuccess {
+			return c, recipeStepError(i+1, cmd.tag)
+		}
+	}
+	return c, nil
+}
+
+// parse provides the command of the step and the remaining arguments, with
+// the step options parsed into the provided Options.
+func (s Step) parse(i int, o *Options) (*command, []string, error) {
+	cmd, ok := commands[s.Command]
+	if !ok || cmd.tag == "run" {
+		return nil, nil, recipeCommandError(i+1, s.Command)
+	}
+	fs := selectionFlags(cmd.tag, o, cmd.ffn(o))
+	var keys []string
+	for k := range s.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var a []string
+	for _, k := range keys {
+		if fs.Lookup(k) == nil {
+			return nil, nil, recipeOptionError(i+1, k, cmd.tag)
+		}
+		v, ok := optionValue(s.Options[k])
+		if !ok {
+			return nil, nil, recipeValueError(i+1, cmd.tag, k, s.Options[k])
+		}
+		a = append(a, fmt.Sprintf("-%s=%s", k, v))
+	}
+	a = append(a, s.Args...)
+	if err := fs.Parse(a); err != nil {
+		return nil, nil, recipeParseError(i+1, cmd.tag, err)
+	}
+	return cmd, fs.Args(), nil
+}
+
+func optionValue(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case bool:
+		return strconv.FormatBool(t), true
+	case int:
+		return strconv.Itoa(t), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	}
+	return "", false
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+type (
+	// A BlendMode provides the BlendFunc of a blend by the value of the blend
+	// -opt flag.
+	BlendMode func(opt float64) BlendFunc
+
+	// An AdjustmentMode provides the AdjustmentFunc of an adjustment by the
+	// amount of change, or nil for no adjustment.
+	AdjustmentMode func(change float64) canvas.AdjustmentFunc
+)
+
+type registeredBlend struct {
+	name string
+	fn   BlendMode
+}
+
+type registeredAdjustment struct {
+	name, instruction string
+	fn                AdjustmentMode
+}
+
+// The resample filters, blend modes and adjustments registered beyond those of
+// core, e.g. by plugins, in order of registration. Commands made after
+// registration provide them alongside the core values.
+var registry = struct {
+	sync.RWMutex
+	filters     []ResampleFilter
+	blends      []registeredBlend
+	adjustments []registeredAdjustment
+}{}
+
+var (
+	RegistryExistsError  = xrr.Xrror("%s %s already exists").Out
+	RegistryInvalidError = xrr.Xrror("%s %s: %s").Out
+)
+
+// Registers the provided ResampleFilter, available to resize by its key.
+func RegisterResampleFilter(f ResampleFilter) error {
+	switch {
+	case f.Key == "":
+		return RegistryInvalidError("resample filter", f.Key, "no key")
+	case f.Fn == nil:
+		return RegistryInvalidError("resample filter", f.Key, "no function")
+	case isFilter(f.Key):
+		return RegistryExistsError("resample filter", f.Key)
+	}
+	registry.Lock()
+	registry.filters = append(registry.filters, f)
+	registry.Unlock()
+	return nil
+}
+
+func isFilter(s string) bool {
+	return s == "nearest" || s == NearestNeighbor.Key || stringToFilter(s).Key != NearestNeighbor.Key
+}
+
+func registeredFilter(s string) (ResampleFilter, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, f := range registry.filters {
+		if f.Key == s {
+			return f, true
+		}
+	}
+	return NearestNeighbor, false
+}
+
+func registeredFilterNames() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var ret []string
+	for _, f := range registry.filters {
+		ret = append(ret, f.Key)
+	}
+	return ret
+}
+
+// Registers the provided BlendMode, available to blend as the -name flag and
+// to layers as the name mode.
+func RegisterBlend(name string, fn BlendMode) error {
+	switch {
+	case name == "":
+		return RegistryInvalidError("blend", name, "no name")
+	case fn == nil:
+		return RegistryInvalidError("blend", name, "no function")
+	}
+	if _, ok := blendMode(name); ok {
+		return RegistryExistsError("blend", name)
+	}
+	registry.Lock()
+	registry.blends = append(registry.blends, registeredBlend{name, fn})
+	registry.Unlock()
+	return nil
+}
+
+func registeredBlendMode(s string) (BlendMode, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, b := range registry.blends {
+		if strings.EqualFold(b.name, s) {
+			return b.fn, true
+		}
+	}
+	return nil, false
+}
+
+func registeredBlendNames() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var ret []string
+	for _, b := range registry.blends {
+		ret = append(ret, b.name)
+	}
+	return ret
+}
+
+// Registers the provided AdjustmentMode, available to adjust as the -name
+// flag with the provided instruction.
+func RegisterAdjustment(name, instruction string, fn AdjustmentMode) error {
+	switch {
+	case name == "":
+		return RegistryInvalidError("adjustment", name, "no name")
+	case fn == nil:
+		return RegistryInvalidError("adjustment", name, "no function")
+	}
+	for _, a := range adjustments {
+		if strings.EqualFold(a.String(), name) {
+			return RegistryExistsError("adjustment", name)
+		}
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, a := range registry.adjustments {
+		if strings.EqualFold(a.name, name) {
+			return RegistryExistsError("adjustment", name)
+		}
+	}
+	registry.adjustments = append(registry.adjustments, registeredAdjustment{name, instruction, fn})
+	return nil
+}
+
+func registeredAdjustments() []registeredAdjustment {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]registeredAdjustment(nil), registry.adjustments...)
+}
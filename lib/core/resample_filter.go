@@ -39,9 +39,35 @@ func stringToFilter(s string) ResampleFilter {
 	case "cosine":
 		return Cosine
 	}
+	if f, ok := registeredFilter(s); ok {
+		return f
+	}
 	return NearestNeighbor
 }
 
+var coreFilterNames = []string{
+	"nearest",
+	"box",
+	"linear",
+	"gaussian",
+	"mitchellnetravali",
+	"catmullrom",
+	"lanczos",
+	"bartlett",
+	"hermite",
+	"bspline",
+	"hann",
+	"hamming",
+	"blackman",
+	"welch",
+	"cosine",
+}
+
+// filterNames provides the names of all core and registered resample filters.
+func filterNames() []string {
+	return append(append([]string(nil), coreFilterNames...), registeredFilterNames()...)
+}
+
 var (
 	NearestNeighbor = canvas.NearestNeighbor
 
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"image"
+	"strings"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+// selectionFlags adds the flags restricting a command to a selection to the
+// flagset of the command with the provided tag.
+func selectionFlags(tag string, o *Options, fs *flip.FlagSet) *flip.FlagSet {
+	v := o.Vector
+	k := func(s string) string { return tag + ".select." + s }
+	fs.StringVector(v, "mask", k("mask"), "Restrict the command to a mask image")
+	fs.StringVectorVar(v, "maskBy", k("maskBy"), "luminance", "Select from the mask image by [alpha|luminance]")
+	fs.IntVector(v, "maskThreshold", k("maskThreshold"), "Fully select mask luminance at or above a threshold, 0 selects by luminance level. [0-255]")
+	fs.StringVector(v, "region", k("region"), "Restrict the command to a region geometry")
+	fs.BoolVector(v, "ellipse", k("ellipse"), "Select the ellipse within the region rather than the rectangle")
+	fs.StringVector(v, "polygon", k("polygon"), "Restrict the command to a polygon of points as 'x,y x,y x,y...'")
+	fs.Float64Vector(v, "feather", k("feather"), "Soften the selection edges over a radius in pixels")
+	fs.BoolVector(v, "invertSelection", k("invert"), "Restrict the command to everything outside the selection")
+	return fs
+}
+
+var (
+	maskByError        = xrr.Xrror("'%s' is not a mask selection [alpha|luminance]").Out
+	maskThresholdError = xrr.Xrror("mask threshold %d is not within 0-255").Out
+	polygonError       = xrr.Xrror("'%s' is not a polygon of at least three x,y points").Out
+)
+
+func selectPolygon(s string) (canvas.Selection, error) {
+	var pts []image.Point
+	for _, f := range strings.Fields(s) {
+		pt, err := layerOffset(f)
+		if err != nil {
+			return nil, polygonError(s)
+		}
+		pts = append(pts, pt)
+	}
+	if len(pts) < 3 {
+		return nil, polygonError(s)
+	}
+	return canvas.PolygonSelection(pts...), nil
+}
+
+func selectMask(o *Options, path, tag string) (canvas.Selection, error) {
+	i, err := canvas.OpenTo(path)
+	if err != nil {
+		return nil, err
+	}
+	switch by := o.ToString(tag + ".select.maskBy"); strings.ToLower(by) {
+	case "alpha":
+		return canvas.AlphaSelection(i), nil
+	case "", "luminance":
+		t := o.ToInt(tag + ".select.maskThreshold")
+		if t < 0 || t > 255 {
+			return nil, maskThresholdError(t)
+		}
+		return canvas.LuminanceSelection(i, uint8(t)), nil
+	default:
+		return nil, maskByError(by)
+	}
+}
+
+// pullSelection provides the Selection given by the options of the command
+// with the provided tag, or nil where none is given.
+func (o *Options) pullSelection(tag string, cv canvas.Canvas) (canvas.Selection, error) {
+	k := func(s string) string { return tag + ".select." + s }
+	var ss []canvas.Selection
+	if m := o.ToString(k("mask")); m != "" {
+		s, err := selectMask(o, m, tag)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	if r := o.ToString(k("region")); r != "" {
+		g, err := resolveGeometry(r, cv)
+		if err != nil {
+			return nil, err
+		}
+		rect := g.Rect(cv.Bounds())
+		if o.ToBool(k("ellipse")) {
+			ss = append(ss, canvas.EllipseSelection(rect))
+		} else {
+			ss = append(ss, canvas.RectSelection(rect))
+		}
+	}
+	if p := o.ToString(k("polygon")); p != "" {
+		s, err := selectPolygon(p)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	if len(ss) == 0 {
+		return nil, nil
+	}
+	sel := ss[0]
+	if len(ss) > 1 {
+		sel = canvas.IntersectSelection(ss...)
+	}
+	sel = canvas.FeatherSelection(sel, o.ToFloat64(k("feather")))
+	if o.ToBool(k("invert")) {
+		sel = canvas.InvertSelection(sel)
+	}
+	return sel, nil
+}
+
+// selectStep sets the selection of the command with the provided tag on the
+// canvas ahead of the command steps, clearing any selection of a prior command.
+func selectStep(tag string) execution {
+	return execution{
+		10,
+		func(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
+			cv := ctx.Canvas(c)
+			if cv == nil {
+				return c, flip.ExitNo
+			}
+			sel, err := o.pullSelection(tag, cv)
+			if err != nil {
+				return c, coreErrorHandler(o, err)
+			}
+			cv.Select(sel)
+			return c, flip.ExitNo
+		},
+	}
+}
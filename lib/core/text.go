@@ -6,10 +6,12 @@ import (
 	"image/color"
 	"image/draw"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/Laughs-In-Flowers/flip"
@@ -46,7 +48,7 @@ var text = NewCommand(
 
 func fontStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
 	dirs := o.ToString("text.fonts.dirs")
-	err := LF.SetDir(FontDirs(dirs)...)
+	err := o.fonts().SetDir(FontDirs(dirs)...)
 	if err != nil {
 		return cv, coreErrorHandler(o, err)
 	}
@@ -55,21 +57,32 @@ func fontStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
 
 func textStep(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
 	o.Printf("executing text")
-	msg := WriteText(cv, o)
+	if _, err := o.pullGeometry(cv, "text.geometry"); err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
+	msg, err := WriteText(cv, o)
+	if err != nil {
+		return cv, coreErrorHandler(o, err)
+	}
 	o.Printf("text wrote: %s", msg)
 	return cv, flip.ExitNo
 }
 
-// Given a canvas and instance of Options, will draw text to the canvas.
-func WriteText(cv canvas.Canvas, o *Options) string {
-	t := OptionsToText(o)
-	t.Scrive(cv)
-	return t.String()
+// Given a canvas and instance of Options, will draw text to the canvas, or to
+// every frame of an animated canvas, within any selection of the canvas.
+func WriteText(cv canvas.Canvas, o *Options) (string, error) {
+	t := OptionsToText(o, cv)
+	err := cv.Draw("text", func(d draw.Image) error {
+		t.Scrive(d)
+		return nil
+	})
+	return t.String(), err
 }
 
-// Translates a set of Options to a Text instance.
-func OptionsToText(o *Options) *Text {
-	g := o.pullGeometry("text.geometry")
+// Translates a set of Options to a Text instance, with any physical units of
+// the geometry resolved by the provided Measure.
+func OptionsToText(o *Options, m canvas.Measure) *Text {
+	g, _ := o.pullGeometry(m, "text.geometry")
 	bw, bh := g.X, g.Y
 	lx, ly := float64(g.OffsetX), float64(g.OffsetY)
 
@@ -86,13 +99,16 @@ func OptionsToText(o *Options) *Text {
 
 	msg := o.ToString("text.message")
 
-	return NewText(
+	t := NewText(
+		o.fonts(),
 		msg,
 		bw, bh,
 		lx, ly,
 		tf, tfz, tc, op,
 		lh, ta, wr, an,
 	)
+	t.Gravity = g.Gravity
+	return t
 }
 
 //
@@ -105,6 +121,7 @@ type Text struct {
 
 //
 func NewText(
+	fonts *Fonts,
 	msg string,
 	bw, bh int,
 	lx, ly float64,
@@ -117,7 +134,7 @@ func NewText(
 	wrap, anchor bool) *Text {
 	b := NewTextBox(bw, bh)
 	l := NewTextLocation(lx, ly)
-	f := LF.TextFont(
+	f := fonts.TextFont(
 		font,
 		fontSize,
 		lineHeight,
@@ -139,7 +156,7 @@ func (t *Text) String() string {
 
 //
 func (t *Text) Scrive(d draw.Image) {
-	bx := t.Box(d)
+	bx := t.fit(d)
 	switch {
 	case t.wrap:
 		t.DrawStringWrapped(bx)
@@ -149,17 +166,49 @@ func (t *Text) Scrive(d draw.Image) {
 		t.DrawString(bx)
 	}
 	mask := image.NewUniform(color.Alpha{uint8(255 * (t.opacity / 100))})
+	size := bx.Bounds().Size()
+	at := t.Gravity.Place(size, d.Bounds(), t.Point())
 	draw.DrawMask(
 		d,
-		d.Bounds(),
+		image.Rectangle{at, at.Add(size)},
 		bx,
-		t.Point(),
+		image.ZP,
 		mask,
 		image.ZP,
 		draw.Over,
 	)
 }
 
+// fit provides the text box, where a box dimension is not set it is fit to the
+// extent of the text within the bounds of the provided image.
+func (t *Text) fit(d draw.Image) draw.Image {
+	b := d.Bounds()
+	w, h := t.TextBox.W, t.TextBox.H
+	if w == 0 {
+		w = b.Dx()
+	}
+	if h == 0 {
+		h = b.Dy()
+	}
+	lines := []string{t.raw}
+	if t.wrap {
+		lines = wordWrap(t.TextFont, t.raw, float64(w))
+	}
+	var ew float64
+	for _, l := range lines {
+		lw, _ := t.MeasureString(l)
+		ew = math.Max(ew, lw)
+	}
+	eh := float64(len(lines))*t.height*t.lineHeight - (t.lineHeight-1)*t.height
+	if t.TextBox.W == 0 {
+		w = int(math.Min(math.Ceil(ew), float64(w)))
+	}
+	if t.TextBox.H == 0 {
+		h = int(math.Min(math.Ceil(eh+t.height/4), float64(h)))
+	}
+	return canvas.Scratch(d.ColorModel(), w, h)
+}
+
 func drawer(i draw.Image, tf *TextFont, x, y float64) *font.Drawer {
 	return &font.Drawer{
 		Dst:  i,
@@ -322,12 +371,13 @@ func (t *TextBox) Box(d draw.Image) draw.Image {
 
 //
 type TextLocation struct {
-	X, Y float64
+	X, Y    float64
+	Gravity geo.Gravity
 }
 
 //
 func NewTextLocation(x, y float64) *TextLocation {
-	return &TextLocation{x, y}
+	return &TextLocation{x, y, geo.NorthWest}
 }
 
 //
@@ -359,18 +409,29 @@ func (t *TextFont) MeasureString(s string) (w, h float64) {
 	return float64(a >> 6), t.height
 }
 
-//
+// A set of named fonts, safe for concurrent use.
 type Fonts struct {
+	mu  sync.RWMutex
 	has map[string]*truetype.Font
 }
 
 //
 func NewFonts() *Fonts {
-	return &Fonts{make(map[string]*truetype.Font)}
+	return &Fonts{has: make(map[string]*truetype.Font)}
+}
+
+// Provides new Fonts holding the default core font.
+func NewCoreFonts() *Fonts {
+	f := NewFonts()
+	ft, _ := Asset("ft/DroidSansMono.ttf")
+	f.SetByte("default", ft)
+	return f
 }
 
 //
 func (f *Fonts) Get(k string) *truetype.Font {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	if gf, exists := f.has[k]; exists {
 		return gf
 	}
@@ -405,7 +466,9 @@ func parseFont(f []byte) (*truetype.Font, error) {
 
 //
 func (f *Fonts) Set(name string, ft *truetype.Font) bool {
+	f.mu.Lock()
 	f.has[name] = ft
+	f.mu.Unlock()
 	return true
 }
 
@@ -436,9 +499,11 @@ func (f *Fonts) SetByte(name string, fb []byte) bool {
 //
 func (f *Fonts) List() []string {
 	var ret AlphaS
+	f.mu.RLock()
 	for k, _ := range f.has {
 		ret = append(ret, k)
 	}
+	f.mu.RUnlock()
 	sort.Sort(ret)
 	return ret
 }
@@ -447,7 +512,10 @@ func (f *Fonts) List() []string {
 func (f *Fonts) SetDir(paths ...string) error {
 	for _, path := range paths {
 		dir, err := ioutil.ReadDir(path)
-		if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			continue // a missing font directory holds no fonts
+		case err != nil:
 			return err
 		}
 		for _, v := range dir {
@@ -468,22 +536,22 @@ func (f *Fonts) SetDir(paths ...string) error {
 	return nil
 }
 
-// local fonts
-var LF *Fonts
-
 var (
-	FontsHome  string
+	FontsHome  = fontsHome()
 	FontsShare = "/usr/share/fonts"
 )
 
-func defaultFontDirs() []string {
+func fontsHome() string {
 	h := os.Getenv("HOME")
 	homeF := fmt.Sprintf("%s/.fonts", h)
-	var err error
-	FontsHome, err = filepath.Abs(homeF)
+	ret, err := filepath.Abs(homeF)
 	if err != nil {
-		FontsHome = "./fonts"
+		return "./fonts"
 	}
+	return ret
+}
+
+func defaultFontDirs() []string {
 	dirs := []string{FontsHome, FontsShare}
 	return dirs
 }
@@ -499,8 +567,3 @@ func FontDirs(dirs string) []string {
 	return ret
 }
 
-func initCoreFonts() {
-	LF = NewFonts()
-	ft, _ := Asset("ft/DroidSansMono.ttf")
-	LF.SetByte("default", ft)
-}
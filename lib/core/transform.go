@@ -1,8 +1,7 @@
 package core
 
 import (
-	"image"
-	"math"
+	"strings"
 
 	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
@@ -21,30 +20,57 @@ var (
 		defaultCommandFunc,
 		coreExec(
 			func(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
-				g := o.pullGeometry("crop.geometry")
-				b := cv.Bounds()
-				var x, y int = b.Max.X, b.Max.Y
-				if g.X != 0 {
-					x = g.X
-				}
-				if g.Y != 0 {
-					y = g.Y
+				g, err := o.pullGeometry(cv, "crop.geometry")
+				if err != nil {
+					return cv, coreErrorHandler(o, err)
 				}
-				rect := image.Rect(g.OffsetX, g.OffsetY, x, y)
+				b := cv.Bounds()
+				rect := g.Rect(b)
 				cv.Printf("execute crop of %v to %v", b, rect)
-				cv.Crop(rect)
+				if err = cv.Crop(rect); err != nil {
+					return cv, coreErrorHandler(o, err)
+				}
 				cv.Print("cropped...")
 				return cv, flip.ExitNo
 			})...,
 	).Command
 
+	extent = NewCommand(
+		"", "extent", "Extend or cut an image to a geometry placed by gravity, filling with a background color", 1,
+		func(o *Options) *flip.FlagSet {
+			v := o.Vector
+			fs := flip.NewFlagSet("extent", flip.ContinueOnError)
+			geo.GeometryVectorFlag(fs, v, "extent.geometry")
+			fs.StringVectorVar(v, "colorType", "extent.color.type", "hex", "The color type specification to use. [hex]")
+			fs.StringVectorVar(v, "background", "extent.color.value", "FFF", "Background color as a string.")
+			return fs
+		},
+		defaultCommandFunc,
+		coreExec(
+			func(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
+				g, err := o.pullGeometry(cv, "extent.geometry")
+				if err != nil {
+					return cv, coreErrorHandler(o, err)
+				}
+				b := cv.Bounds()
+				rect := g.Rect(b)
+				cv.Printf("execute extent of %v to %v", b, rect)
+				bg := ToColor(o.ToString("extent.color.type"), o.ToString("extent.color.value"))
+				if err = cv.Extent(rect, bg); err != nil {
+					return cv, coreErrorHandler(o, err)
+				}
+				cv.Print("extended...")
+				return cv, flip.ExitNo
+			})...,
+	).Command
+
 	resize = NewCommand(
 		"", "resize", "Resize an image", 1,
 		func(o *Options) *flip.FlagSet {
 			v := o.Vector
 			fs := flip.NewFlagSet("resize", flip.ContinueOnError)
 			geo.GeometryVectorFlag(fs, v, "resize.geometry")
-			fs.StringVectorVar(v, "filter", "resize.filter", "nearest", "the resample filter to use in resizing\n\t\t[nearest|\n\t\tbox|\n\t\tlinear|\n\t\tgaussian|\n\t\tmitchellnetravali|\n\t\tcatmullrom|\n\t\tlanczos|\n\t\tbartlett|\n\t\thermite|\n\t\tbspline|\n\t\thann|\n\t\thamming|\n\t\tblackman|\n\t\twelch|\n\t\tcosine]")
+			fs.StringVectorVar(v, "filter", "resize.filter", "nearest", "the resample filter to use in resizing\n\t\t["+strings.Join(filterNames(), "|\n\t\t")+"]")
 			return fs
 		},
 		defaultCommandFunc,
@@ -52,30 +78,14 @@ var (
 			func(o *Options, cv canvas.Canvas) (canvas.Canvas, flip.ExitStatus) {
 				b := cv.Bounds()
 				cv.Printf("execute resize of (w:%d, h: %d)", b.Max.X, b.Max.Y)
-				var aw, ah int
-				w, h := b.Max.X, b.Max.Y
-				g := o.pullGeometry("resize.geometry")
-				if g.X != 0 {
-					aw = g.X
-				}
-				if g.Y != 0 {
-					ah = g.Y
-				}
-				if g.ScaleX > 0 {
-					aw = int(float64(w) * ((g.ScaleX / 100) + 1))
-				}
-				if g.ScaleX < 0 {
-					aw = int(float64(w) * (1 - (math.Abs(g.ScaleX) / 100)))
-				}
-				if g.ScaleY > 0 {
-					ah = int(float64(h) * ((g.ScaleY / 100) + 1))
-				}
-				if g.ScaleY < 0 {
-					ah = int(float64(h) * (1 - (math.Abs(g.ScaleY) / 100)))
+				g, err := o.pullGeometry(cv, "resize.geometry")
+				if err != nil {
+					return cv, coreErrorHandler(o, err)
 				}
+				aw, ah := g.Size(b.Dx(), b.Dy())
 				filter := stringToFilter(o.ToString("resize.filter"))
 				cv.Printf("resizing to (w: %d, h: %d)", aw, ah)
-				err := cv.Resize(aw, ah, filter)
+				err = cv.Resize(aw, ah, filter)
 				cv.Printf("resized....")
 				if err != nil {
 					return cv, coreErrorHandler(o, err)
@@ -87,5 +97,6 @@ var (
 
 func registerTransformCmds(cm cmdMap) {
 	cm.Register("crop", crop)
+	cm.Register("extent", extent)
 	cm.Register("resize", resize)
 }
@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Laughs-In-Flowers/xrr"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The environment variable listing plugin directories, separated as PATH is,
+// in place of the XDG plugin directories.
+const PathEnv = "WARHOLA_PLUGIN_PATH"
+
+// The plugin directory relative to the working directory, always searched.
+var PluginsLocal = "plugins"
+
+func xdgDir(env, home string) string {
+	if d := os.Getenv(env); d != "" {
+		return d
+	}
+	return filepath.Join(os.Getenv("HOME"), home)
+}
+
+func xdgDirs(env, def string) []string {
+	d := os.Getenv(env)
+	if d == "" {
+		d = def
+	}
+	return filepath.SplitList(d)
+}
+
+// Provides the XDG plugin directories: warhola/plugins of the XDG data home,
+// the XDG config home, and each XDG data directory.
+func XDGDirs() []string {
+	ret := []string{
+		filepath.Join(xdgDir("XDG_DATA_HOME", ".local/share"), "warhola", "plugins"),
+		filepath.Join(xdgDir("XDG_CONFIG_HOME", ".config"), "warhola", "plugins"),
+	}
+	for _, d := range xdgDirs("XDG_DATA_DIRS", "/usr/local/share:/usr/share") {
+		ret = append(ret, filepath.Join(d, "warhola", "plugins"))
+	}
+	return ret
+}
+
+func defaultDirs() []string {
+	ret := []string{PluginsLocal}
+	if p := os.Getenv(PathEnv); p != "" {
+		return append(ret, filepath.SplitList(p)...)
+	}
+	return append(ret, XDGDirs()...)
+}
+
+// Provides the default plugin directories followed by those of the provided
+// comma separated list. The defaults are the local plugins directory, and the
+// directories of WARHOLA_PLUGIN_PATH where set, or else the XDG directories.
+func Dirs(dirs string) []string {
+	var ret = defaultDirs()
+	spl := strings.Split(dirs, ",")
+	for _, v := range spl {
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// Provides the path of the plugin configuration file, plugins.yaml of the
+// warhola directory of the XDG config home.
+func ConfigPath() string {
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", ".config"), "warhola", "plugins.yaml")
+}
+
+// A Filter of the plugins a Loader loads, by the file name of each in its
+// directory, e.g.
+//
+//	allow: [warhola-invert, qoi.so]
+//	deny: ["*-beta*"]
+//
+// Names are file names or filepath.Match patterns. Where Allow lists any name
+// only plugins matching it are loaded, and no plugin matching Deny is.
+type Filter struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+var FilterConfigError = xrr.Xrror("plugin configuration %s: %s").Out
+
+// Reads the Filter of the plugin configuration file at path, an empty Filter
+// where no file exists, and any error.
+func ReadFilter(path string) (*Filter, error) {
+	f := &Filter{}
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return f, nil
+	case err != nil:
+		return nil, err
+	}
+	if err = yaml.UnmarshalStrict(b, f); err != nil {
+		return nil, FilterConfigError(path, err)
+	}
+	for _, p := range append(append([]string(nil), f.Allow...), f.Deny...) {
+		if _, err = filepath.Match(p, ""); err != nil {
+			return nil, FilterConfigError(path, err)
+		}
+	}
+	return f, nil
+}
+
+var (
+	NotAllowedError = xrr.Xrror("not allowed by plugin configuration")
+	DeniedError     = xrr.Xrror("denied by plugin configuration")
+)
+
+func matches(patterns []string, file string) bool {
+	for _, p := range patterns {
+		if m, _ := filepath.Match(p, file); m {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed provides an error where the Filter excludes the plugin file.
+func (f *Filter) allowed(file string) error {
+	switch {
+	case f == nil:
+		return nil
+	case len(f.Allow) > 0 && !matches(f.Allow, file):
+		return NotAllowedError
+	case matches(f.Deny, file):
+		return DeniedError
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/core"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+// Executable plugins
+//
+// Besides Go plugins, a plugin directory may hold executables of any language
+// contributing commands to warhola, with no need to share its toolchain or
+// dependencies. A regular, executable file of a plugin directory named with
+// the ExecPrefix, e.g. warhola-invert, is an executable plugin; no other file
+// is ever run.
+//
+// warhola runs the executable once per request, with no arguments, writing a
+// single JSON Request to its stdin and reading a single JSON Response from its
+// stdout before it exits. Anything written to stderr is reported when the
+// executable exits with a non zero status. An executable not exiting within
+// ExecTimeout is killed, failing the request.
+//
+// A request of type "manifest" asks for the Manifest of the executable, with
+// the commands it contributes and the flags of each. An executable whose
+// manifest is invalid or incompatible, or holds a command of the tag of a core
+// command, is skipped:
+//
+//	{"protocol": 1, "type": "manifest"}
+//
+//	{"manifest": {"name": "invert", "version": "1.0.0", "api": 1,
+//	  "description": "Color inversion", "commands": [{"tag": "invert",
+//	  "instruction": "Invert the colors of a canvas", "format": "raw",
+//	  "flags": [{"name": "amount", "type": "int", "default": 255,
+//	  "usage": "The amount of inversion"}]}]}}
+//
+// A request of type "command" runs a command of the manifest against one
+// frame of a canvas, with the value of each flag and the pixels of the frame
+// in an Envelope of the format the command asks for:
+//
+//	{"protocol": 1, "type": "command", "command": "invert",
+//	 "flags": {"amount": 255}, "image": {"format": "raw", "width": 2,
+//	 "height": 1, "stride": 8, "data": "/wAA//8AAP8="}}
+//
+// and is answered with the resulting frame in an Envelope of either format,
+// along with any lines to log:
+//
+//	{"image": {"format": "png", "data": "iVBORw0KGgo..."}, "log": ["inverted"]}
+//
+// A Response with an error fails the request:
+//
+//	{"error": "amount out of range"}
+
+// The version of the executable plugin protocol sent with every Request.
+const ProtocolVersion = 1
+
+// The prefix of the file name of every executable plugin.
+const ExecPrefix = "warhola-"
+
+// The time an executable plugin has to answer any single Request.
+var ExecTimeout = 30 * time.Second
+
+// The types of Request made to an executable plugin.
+const (
+	ManifestRequest = "manifest"
+	CommandRequest  = "command"
+)
+
+// A Request written to the stdin of an executable plugin.
+type Request struct {
+	Protocol int                    `json:"protocol"`
+	Type     string                 `json:"type"`
+	Command  string                 `json:"command,omitempty"`
+	Flags    map[string]interface{} `json:"flags,omitempty"`
+	Image    *Envelope              `json:"image,omitempty"`
+}
+
+// A Response read from the stdout of an executable plugin.
+type Response struct {
+	Manifest *Manifest `json:"manifest,omitempty"`
+	Image    *Envelope `json:"image,omitempty"`
+	Log      []string  `json:"log,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// A command contributed by an executable plugin. Format is the Envelope format
+// of the frames sent to the command, raw where empty.
+type ManifestCommand struct {
+	Tag         string         `json:"tag"`
+	Instruction string         `json:"instruction"`
+	Priority    int            `json:"priority"`
+	Format      string         `json:"format"`
+	Flags       []ManifestFlag `json:"flags"`
+}
+
+// A flag of a command contributed by an executable plugin, of type string,
+// int, float or bool, string where empty.
+type ManifestFlag struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Default interface{} `json:"default"`
+	Usage   string      `json:"usage"`
+}
+
+// The formats of an Envelope.
+const (
+	RawFormat = "raw"
+	PNGFormat = "png"
+)
+
+// An Envelope holding the pixels of an image. Raw data is 8 bit, non alpha
+// premultiplied RGBA in rows of stride bytes; png data is an encoded png, of
+// which the width, height and stride may be omitted.
+type Envelope struct {
+	Format string `json:"format"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Stride int    `json:"stride,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+var (
+	EnvelopeFormatError = xrr.Xrror("unknown envelope format: %s").Out
+	EnvelopeSizeError   = xrr.Xrror("raw envelope of %dx%d, stride %d, holds %d bytes").Out
+)
+
+// Provides a new Envelope of the provided format holding the provided image,
+// and any error.
+func NewEnvelope(format string, i image.Image) (*Envelope, error) {
+	b := i.Bounds()
+	switch format {
+	case "", RawFormat:
+		n := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(n, n.Rect, i, b.Min, draw.Src)
+		return &Envelope{RawFormat, b.Dx(), b.Dy(), n.Stride, n.Pix}, nil
+	case PNGFormat:
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, i); err != nil {
+			return nil, err
+		}
+		return &Envelope{PNGFormat, b.Dx(), b.Dy(), 0, buf.Bytes()}, nil
+	}
+	return nil, EnvelopeFormatError(format)
+}
+
+// Provides the image held by the Envelope, and any error.
+func (e *Envelope) Image() (image.Image, error) {
+	switch e.Format {
+	case "", RawFormat:
+		if e.Width < 0 || e.Height < 0 || e.Stride < e.Width*4 ||
+			(e.Height > 0 && len(e.Data) < e.Stride*(e.Height-1)+e.Width*4) {
+			return nil, EnvelopeSizeError(e.Width, e.Height, e.Stride, len(e.Data))
+		}
+		return &image.NRGBA{Pix: e.Data, Stride: e.Stride, Rect: image.Rect(0, 0, e.Width, e.Height)}, nil
+	case PNGFormat:
+		return png.Decode(bytes.NewReader(e.Data))
+	}
+	return nil, EnvelopeFormatError(e.Format)
+}
+
+var (
+	//
+	ExecPluginError = xrr.Xrror("Error with executable plugin at %s:\n\t%s").Out
+	//
+	ManifestError = xrr.Xrror("Executable plugin at %s has an invalid manifest: %s").Out
+	//
+	ExecTimeoutError = xrr.Xrror("Executable plugin at %s did not answer within %s").Out
+)
+
+// call runs the executable at path with the provided Request, killing it when
+// the context is done or ExecTimeout passes, providing its Response and any
+// error.
+func call(x context.Context, path string, r *Request) (*Response, error) {
+	r.Protocol = ProtocolVersion
+	in, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	x, cancel := context.WithTimeout(x, ExecTimeout)
+	defer cancel()
+	out, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.CommandContext(x, path)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = out
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if x.Err() == context.DeadlineExceeded {
+			return nil, ExecTimeoutError(path, ExecTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, ExecPluginError(path, fmt.Sprintf("%s: %s", err, msg))
+		}
+		return nil, ExecPluginError(path, err)
+	}
+	res := &Response{}
+	if err := json.Unmarshal(out.Bytes(), res); err != nil {
+		return nil, ExecPluginError(path, err)
+	}
+	if res.Error != "" {
+		return res, ExecPluginError(path, res.Error)
+	}
+	return res, nil
+}
+
+type execCmd struct {
+	path string
+	ManifestCommand
+}
+
+type execLoader struct {
+	dir    string
+	loaded map[string]*execCmd
+	status []Status
+	filter *Filter
+}
+
+func newExecLoader(dir string) *execLoader {
+	return &execLoader{loaderDir(dir), nil, nil, nil}
+}
+
+// Does not add a directory, single directory is specified at instantiation.
+func (l *execLoader) AddDir(string) error { return nil }
+
+// Satisfies the interface Loader.Load function for this *execLoader, requesting
+// the manifest of each executable plugin in the directory.
+func (l *execLoader) Load() error {
+	if l.loaded == nil {
+		l.loaded = make(map[string]*execCmd)
+	}
+	plugins, err := l.Plugins()
+	if err != nil {
+		return nil // as with Go plugins, a missing directory holds no plugins
+	}
+	l.status = nil
+	for _, v := range plugins {
+		for _, plugin := range v {
+			if err = l.filter.allowed(plugin); err != nil {
+				l.status = append(l.status, Status{l.dir, plugin, nil, err})
+				continue
+			}
+			m, err := loadExec(l, filepath.Join(l.dir, plugin))
+			l.status = append(l.status, Status{l.dir, plugin, m, err})
+		}
+	}
+	return nil
+}
+
+func loadExec(l *execLoader, path string) (*Manifest, error) {
+	res, err := call(context.Background(), path, &Request{Type: ManifestRequest})
+	if err != nil {
+		return nil, err
+	}
+	m := res.Manifest
+	if m == nil {
+		return nil, ManifestError(path, "no manifest")
+	}
+	if err = m.compatible(); err != nil {
+		return m, err
+	}
+	for _, mc := range m.Commands {
+		if mc.Tag == "" {
+			return m, ManifestError(path, "command with no tag")
+		}
+		if _, ok := core.Core[mc.Tag]; ok {
+			return m, ManifestError(path, fmt.Sprintf("command %s shadows a core command", mc.Tag))
+		}
+		for _, f := range mc.Flags {
+			if _, err := flagValue(f.Type, f.Default); err != nil {
+				return m, ManifestError(path, fmt.Sprintf("flag %s of %s: %s", f.Name, mc.Tag, err))
+			}
+		}
+	}
+	for _, mc := range m.Commands {
+		l.loaded[mc.Tag] = &execCmd{path, mc}
+	}
+	return m, nil
+}
+
+// Satisfies the interface Loader.Status function for this *execLoader
+func (l *execLoader) Status() []Status {
+	return l.status
+}
+
+// Satisfies the interface Loader.Plugins function for this *execLoader, listing
+// the executables of the directory named with the ExecPrefix.
+func (l *execLoader) Plugins() (map[string][]string, error) {
+	dir, err := os.Open(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	fis, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string][]string)
+	var res []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.Mode().IsRegular() && fi.Mode()&0111 != 0 &&
+			strings.HasPrefix(name, ExecPrefix) && filepath.Ext(name) != ".so" {
+			res = append(res, name)
+		}
+	}
+	ret[l.dir] = res
+
+	return ret, nil
+}
+
+// Satisfies the interface Loader.Get function for this *execLoader
+func (l *execLoader) Get(tags ...string) ([]flip.Command, error) {
+	var ret = make([]flip.Command, 0)
+
+	switch {
+	case len(tags) > 0 && tags[0] == "ALL":
+		for _, ec := range l.loaded {
+			ret = append(ret, ec.command())
+		}
+		return ret, nil
+	default:
+		for _, tag := range tags {
+			ec, ok := l.loaded[tag]
+			if !ok {
+				return nil, PluginDoesNotExistError(tag)
+			}
+			ret = append(ret, ec.command())
+		}
+	}
+	return ret, nil
+}
+
+var (
+	FlagTypeError  = xrr.Xrror("unknown flag type %s").Out
+	FlagValueError = xrr.Xrror("%s is not an %s").Out
+)
+
+// flagValue provides the value of v as the provided flag type, and any error.
+func flagValue(typ string, v interface{}) (interface{}, error) {
+	s := ""
+	if v != nil {
+		s = fmt.Sprintf("%v", v)
+	}
+	switch typ {
+	case "", "string":
+		return s, nil
+	case "int":
+		if s == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f != float64(int(f)) {
+			return nil, FlagValueError(s, typ)
+		}
+		return int(f), nil
+	case "float":
+		if s == "" {
+			return 0.0, nil
+		}
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		if s == "" {
+			return false, nil
+		}
+		return strconv.ParseBool(s)
+	}
+	return nil, FlagTypeError(typ)
+}
+
+func (ec *execCmd) flags() (*flip.FlagSet, func() map[string]interface{}) {
+	fs := flip.NewFlagSet(ec.Tag, flip.ContinueOnError)
+	vals := make(map[string]func() interface{})
+	for _, f := range ec.Flags {
+		d, _ := flagValue(f.Type, f.Default)
+		switch d := d.(type) {
+		case int:
+			v := new(int)
+			fs.IntVar(v, f.Name, d, f.Usage)
+			vals[f.Name] = func() interface{} { return *v }
+		case float64:
+			v := new(float64)
+			fs.Float64Var(v, f.Name, d, f.Usage)
+			vals[f.Name] = func() interface{} { return *v }
+		case bool:
+			v := new(bool)
+			fs.BoolVar(v, f.Name, d, f.Usage)
+			vals[f.Name] = func() interface{} { return *v }
+		case string:
+			v := new(string)
+			fs.StringVar(v, f.Name, d, f.Usage)
+			vals[f.Name] = func() interface{} { return *v }
+		}
+	}
+	return fs, func() map[string]interface{} {
+		ret := make(map[string]interface{})
+		for k, fn := range vals {
+			ret[k] = fn()
+		}
+		return ret
+	}
+}
+
+var NoCanvasError = xrr.Xrror("no canvas to run %s against").Out
+
+func (ec *execCmd) command() flip.Command {
+	fs, values := ec.flags()
+	return flip.NewCommand(
+		"",
+		ec.Tag,
+		ec.Instruction,
+		ec.Priority,
+		false,
+		func(c context.Context, a []string) (context.Context, flip.ExitStatus) {
+			l := ctx.Log(c)
+			cv := ctx.Canvas(c)
+			if cv == nil {
+				l.Println(NoCanvasError(ec.Tag))
+				return c, flip.ExitFailure
+			}
+			flags := values()
+			err := cv.EachFrame(func(_ int, fc canvas.Canvas) error {
+				return ec.run(c, fc, flags, func(msg string) { l.Printf("%s: %s", ec.Tag, msg) })
+			})
+			if err != nil {
+				l.Println(err)
+				return c, flip.ExitFailure
+			}
+			return ctx.WithCanvas(c, cv), flip.ExitSuccess
+		},
+		fs,
+	)
+}
+
+// run sends the frame with the flags to the executable, replacing the frame
+// with the image of the Response.
+func (ec *execCmd) run(x context.Context, fc canvas.Canvas, flags map[string]interface{}, logFn func(string)) error {
+	e, err := NewEnvelope(ec.Format, fc)
+	if err != nil {
+		return err
+	}
+	res, err := call(x, ec.path, &Request{
+		Type:    CommandRequest,
+		Command: ec.Tag,
+		Flags:   flags,
+		Image:   e,
+	})
+	if err != nil {
+		return err
+	}
+	for _, msg := range res.Log {
+		logFn(msg)
+	}
+	if res.Image == nil {
+		return ExecPluginError(ec.path, "no image in response")
+	}
+	i, err := res.Image.Image()
+	if err != nil {
+		return ExecPluginError(ec.path, err)
+	}
+	return fc.Replace(i)
+}
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	p "plugin"
+	"strings"
+	"sync"
 
 	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/warhola/lib/core"
@@ -18,17 +20,60 @@ type Loader interface {
 	Load() error
 	Plugins() (map[string][]string, error)
 	Get(...string) ([]flip.Command, error)
+	Status() []Status
+}
+
+// The version of the warhola plugin API. A plugin requiring a later version is
+// incompatible, and skipped on loading.
+const APIVersion = 1
+
+// The Manifest of a plugin. Go plugins export it as the Manifest variable,
+// executable plugins provide it in answer to a manifest request along with the
+// commands they contribute. API is the version of the warhola plugin API the
+// plugin requires.
+type Manifest struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	API         int               `json:"api"`
+	Description string            `json:"description"`
+	Commands    []ManifestCommand `json:"commands,omitempty"`
+}
+
+var (
+	ManifestNameError = xrr.Xrror("plugin manifest has no name")
+	IncompatibleError = xrr.Xrror("plugin %s requires warhola plugin API %d, this warhola provides %d").Out
+)
+
+// compatible provides an error where the Manifest is unusable by this warhola.
+func (m *Manifest) compatible() error {
+	switch {
+	case m.Name == "":
+		return ManifestNameError
+	case m.API > APIVersion:
+		return IncompatibleError(m.Name, m.API, APIVersion)
+	}
+	return nil
+}
+
+// The load Status of a plugin file of a directory: its Manifest where one was
+// read, and any error by which it was skipped.
+type Status struct {
+	Dir, File string
+	Manifest  *Manifest
+	Err       error
 }
 
 type loaders struct {
-	has []Loader
+	has    []Loader
+	dirs   map[string]bool
+	filter *Filter
 }
 
 // Provides a new, multiple directory handling Loader.
 func New(dirs ...string) (*loaders, error) {
 	def := make([]Loader, 0)
 	def = append(def, Core)
-	ret := &loaders{def}
+	ret := &loaders{def, make(map[string]bool), &Filter{}}
 	for _, d := range dirs {
 		err := ret.AddDir(d)
 		if err != nil {
@@ -38,26 +83,57 @@ func New(dirs ...string) (*loaders, error) {
 	return ret, nil
 }
 
-// Adds a new directory to this *loaders instance.
+// Adds a new directory to this *loaders instance, loading both the Go plugins
+// and the executable plugins of the directory. A directory already added is
+// not added again.
 func (l *loaders) AddDir(dir string) error {
+	d := loaderDir(dir)
+	if l.dirs[d] {
+		return nil
+	}
 	nl, err := newLoader(dir)
 	if err != nil {
 		return err
 	}
-	l.has = append(l.has, nl)
+	nl.filter = l.filter
+	el := newExecLoader(dir)
+	el.filter = l.filter
+	l.has = append(l.has, nl, el)
+	l.dirs[d] = true
 	return nil
 }
 
-// Loads plugins from all directories, returning any error.
+// Sets the Filter of the plugins loaded from every directory.
+func (l *loaders) SetFilter(f *Filter) {
+	*l.filter = *f
+}
+
+// Loads plugins from all directories, returning any errors.
 func (l *loaders) Load() error {
-	var err error
+	var errs []error
 	for _, ld := range l.has {
-		err = ld.Load()
-		if err != nil {
-			return err
+		if err := ld.Load(); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return err
+	return aggregate(errs)
+}
+
+var PluginErrors = xrr.Xrror("plugin errors: %s").Out
+
+// aggregate provides a single error of all the provided errors, or nil.
+func aggregate(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return PluginErrors(strings.Join(msgs, "; "))
 }
 
 // Provides a map[string][]string of all plugins managed by this *loaders instance
@@ -68,7 +144,7 @@ func (l *loaders) Plugins() (map[string][]string, error) {
 	for _, sl := range l.has {
 		ps, _ := sl.Plugins()
 		for k, v := range ps {
-			ret[k] = v
+			ret[k] = append(ret[k], v...)
 		}
 	}
 	return ret, nil
@@ -77,16 +153,44 @@ func (l *loaders) Plugins() (map[string][]string, error) {
 // An error indicating the named plugin does not exist.
 var PluginDoesNotExistError = xrr.Xrror("plugin does not exist: %s").Out
 
-// Provided any number of string tags, returns an array of flip.Command and any error.
+// Provided any number of string tags, returns an array of flip.Command and any
+// error, of every tag no directory provides a plugin for.
 func (l *loaders) Get(tags ...string) ([]flip.Command, error) {
 	var ret = make([]flip.Command, 0)
-	var err error
+	var errs []error
+	if len(tags) > 0 && tags[0] == "ALL" {
+		for _, ll := range l.has {
+			ps, err := ll.Get(tags...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			ret = append(ret, ps...)
+		}
+		return ret, aggregate(errs)
+	}
+	for _, tag := range tags {
+		var found bool
+		for _, ll := range l.has {
+			if ps, err := ll.Get(tag); err == nil {
+				ret = append(ret, ps...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, PluginDoesNotExistError(tag))
+		}
+	}
+	return ret, aggregate(errs)
+}
+
+// Provides the Status of every plugin of every directory.
+func (l *loaders) Status() []Status {
+	var ret []Status
 	for _, ll := range l.has {
-		var ps []flip.Command
-		ps, err = ll.Get(tags...)
-		ret = append(ret, ps...)
+		ret = append(ret, ll.Status()...)
 	}
-	return ret, err
+	return ret
 }
 
 type loader struct {
@@ -94,6 +198,8 @@ type loader struct {
 	llfn   func(*loader) error
 	plfn   func(*loader) (map[string][]string, error)
 	loaded map[string]pluginCmd
+	status []Status
+	filter *Filter
 }
 
 func loaderDir(d string) string {
@@ -107,6 +213,8 @@ func newLoader(dir string) (*loader, error) {
 		defaultLoaderFunc,
 		defaultPluginLister,
 		nil,
+		nil,
+		nil,
 	}, nil
 }
 
@@ -123,48 +231,115 @@ func defaultLoaderFunc(l *loader) error {
 	if err != nil {
 		return nil // pass through here and do nothing, its less mess
 	}
+	l.status = nil
 	for _, v := range plugins {
-		var srcPath string
 		for _, plugin := range v {
-			srcPath = filepath.Join(l.dir, plugin)
-			err = loadPath(l, srcPath)
-			if err != nil {
-				return err
+			if err = l.filter.allowed(plugin); err != nil {
+				l.status = append(l.status, Status{l.dir, plugin, nil, err})
+				continue
 			}
+			m, err := loadPath(l, filepath.Join(l.dir, plugin))
+			l.status = append(l.status, Status{l.dir, plugin, m, err})
 		}
 	}
 	return nil
 }
 
-func loadPath(l *loader, path string) error {
+// loadPath opens the Go plugin at path, which exports a Manifest, or for
+// plugins preceding manifests a PluginName, and either or both of a Command
+// function providing its command, and a Register function extending the
+// registries of core and canvas, e.g. with core.RegisterBlend or
+// canvas.RegisterFileType. Neither function of an incompatible plugin is used.
+func loadPath(l *loader, path string) (*Manifest, error) {
 	p, err := p.Open(path)
 	if err != nil {
-		return OpenPluginError(path, err)
+		return nil, OpenPluginError(path, err)
 	}
-	u1, err := p.Lookup("PluginName")
+	m, err := pluginManifest(p, path)
 	if err != nil {
-		return DoesntExistError(path, "name")
+		return m, err
 	}
-	u2, err := p.Lookup("Command")
-	if err != nil {
-		return DoesntExistError(path, "command function")
+	if err = m.compatible(); err != nil {
+		return m, err
+	}
+	u2, cErr := p.Lookup("Command")
+	u3, rErr := p.Lookup("Register")
+	if cErr != nil && rErr != nil {
+		return m, DoesntExistError(path, "command or register function")
 	}
 
-	var key *string
-	var value func() flip.Command
 	var ok bool
+	var value func() flip.Command
+	if cErr == nil {
+		if value, ok = u2.(func() flip.Command); !ok {
+			return m, OpenPluginError(path, "error with plugin command function")
+		}
+	}
 
-	if key, ok = u1.(*string); !ok {
-		return OpenPluginError(path, "error with plugin name")
+	if rErr == nil {
+		var register func() error
+		if register, ok = u3.(func() error); !ok {
+			return m, OpenPluginError(path, "error with plugin register function")
+		}
+		if err = registerOnce(path, register); err != nil {
+			return m, OpenPluginError(path, err)
+		}
 	}
 
-	if value, ok = u2.(func() flip.Command); !ok {
-		return OpenPluginError(path, "error with plugin command function")
+	if value != nil {
+		l.loaded[m.Name] = value
 	}
 
-	l.loaded[*key] = value
+	return m, nil
+}
+
+type registration struct {
+	once sync.Once
+	err  error
+}
 
-	return nil
+var (
+	registerMu sync.Mutex
+	registered = make(map[string]*registration)
+)
+
+// registerOnce calls the Register function of the Go plugin at path once only,
+// as a Go plugin is opened once per process and a loader may load it again,
+// providing the error of that call on every load.
+func registerOnce(path string, register func() error) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	registerMu.Lock()
+	r, ok := registered[path]
+	if !ok {
+		r = &registration{}
+		registered[path] = r
+	}
+	registerMu.Unlock()
+	r.once.Do(func() { r.err = register() })
+	return r.err
+}
+
+// pluginManifest provides the Manifest of the opened plugin, or a Manifest of
+// the PluginName of a plugin preceding manifests.
+func pluginManifest(p *p.Plugin, path string) (*Manifest, error) {
+	if u, err := p.Lookup("Manifest"); err == nil {
+		m, ok := u.(*Manifest)
+		if !ok {
+			return nil, OpenPluginError(path, "error with plugin manifest")
+		}
+		return m, nil
+	}
+	u, err := p.Lookup("PluginName")
+	if err != nil {
+		return nil, DoesntExistError(path, "manifest")
+	}
+	key, ok := u.(*string)
+	if !ok {
+		return nil, OpenPluginError(path, "error with plugin name")
+	}
+	return &Manifest{Name: *key}, nil
 }
 
 // Satisfies the interface Loader.Load function for this *loader
@@ -208,6 +383,11 @@ func (l *loader) Plugins() (map[string][]string, error) {
 	return l.plfn(l)
 }
 
+// Satisfies the interface Loader.Status function for this *loader
+func (l *loader) Status() []Status {
+	return l.status
+}
+
 // Satisfies the interface Loader.Get function for this *loader
 func (l *loader) Get(tags ...string) ([]flip.Command, error) {
 	var ret = make([]flip.Command, 0)
@@ -234,16 +414,18 @@ func (l *loader) Get(tags ...string) ([]flip.Command, error) {
 	return ret, nil
 }
 
+var coreLoad sync.Once
+
 // A customised always loaded Loader encapsulating core functionality
 var Core *loader = &loader{
 	"core",
 	func(l *loader) error {
-		if l.loaded == nil {
+		coreLoad.Do(func() {
 			l.loaded = make(map[string]pluginCmd)
 			for k, fn := range core.Core {
 				l.loaded[k] = fn
 			}
-		}
+		})
 		return nil
 	},
 	func(l *loader) (map[string][]string, error) {
@@ -257,4 +439,6 @@ var Core *loader = &loader{
 		return ret, nil
 	},
 	nil,
+	nil,
+	nil,
 }
@@ -1,5 +1,273 @@
 package plugin_test
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/log"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/plugin"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+)
+
+// With WARHOLA_TEST_PLUGIN set the test binary is an executable plugin.
+func TestMain(m *testing.M) {
+	if p := os.Getenv("WARHOLA_TEST_PLUGIN"); p != "" {
+		os.Exit(execPlugin(p))
+	}
+	os.Exit(m.Run())
+}
+
+// execPlugin serves an invert command, answering with png envelopes, as the
+// invert plugin, requires a future plugin API as the future plugin, or serves
+// the core resize command as the shadow plugin.
+func execPlugin(name string) int {
+	req := &plugin.Request{}
+	if err := json.NewDecoder(os.Stdin).Decode(req); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	res := &plugin.Response{}
+	switch req.Type {
+	case plugin.ManifestRequest:
+		res.Manifest = &plugin.Manifest{
+			Name:        name,
+			Version:     "1.0.0",
+			API:         plugin.APIVersion,
+			Description: "Color inversion",
+			Commands: []plugin.ManifestCommand{{
+				Tag:         "invert",
+				Instruction: "Invert the colors of a canvas",
+				Flags: []plugin.ManifestFlag{
+					{Name: "amount", Type: "int", Default: 255, Usage: "The amount of inversion"},
+				},
+			}},
+		}
+	case plugin.CommandRequest:
+		i, err := req.Image.Image()
+		if err != nil {
+			res.Error = err.Error()
+			break
+		}
+		amount := uint8(req.Flags["amount"].(float64))
+		n := image.NewNRGBA(i.Bounds())
+		draw.Draw(n, n.Rect, i, image.ZP, draw.Src)
+		for p := 0; p < len(n.Pix); p += 4 {
+			n.Pix[p], n.Pix[p+1], n.Pix[p+2] = amount-n.Pix[p], amount-n.Pix[p+1], amount-n.Pix[p+2]
+		}
+		res.Image, _ = plugin.NewEnvelope(plugin.PNGFormat, n)
+		res.Log = []string{"inverted"}
+	}
+	switch {
+	case name == "future" && res.Manifest != nil:
+		res.Manifest.API = plugin.APIVersion + 1
+	case name == "shadow" && res.Manifest != nil:
+		res.Manifest.Commands[0].Tag = "resize"
+	}
+	json.NewEncoder(os.Stdout).Encode(res)
+	return 0
+}
+
+func writeExecPlugin(t *testing.T, dir, name string) {
+	self, _ := filepath.Abs(os.Args[0])
+	script := fmt.Sprintf("#!/bin/sh\nWARHOLA_TEST_PLUGIN=%s exec %q\n", name, self)
+	if err := ioutil.WriteFile(filepath.Join(dir, plugin.ExecPrefix+name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
 
 func TestLoader(t *testing.T) {}
+
+func TestExecLoader(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable plugin test script needs a posix shell")
+	}
+	dir, err := ioutil.TempDir("", "warhola-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeExecPlugin(t, dir, "invert")
+	writeExecPlugin(t, dir, "future")
+	writeExecPlugin(t, dir, "shadow")
+	ioutil.WriteFile(filepath.Join(dir, "warhola-broken"), []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "unmarked"), []byte("#!/bin/sh\nexit 1\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a plugin"), 0644)
+
+	l, err := plugin.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatalf("load error: %s", err)
+	}
+	ps, _ := l.Plugins()
+	if got := ps[dir]; len(got) != 4 {
+		t.Errorf("expected 4 executable plugins in %s, got %v", dir, got)
+	}
+	for _, s := range l.Status() {
+		switch s.File {
+		case "warhola-invert":
+			if s.Err != nil || s.Manifest == nil || s.Manifest.Version != "1.0.0" {
+				t.Errorf("expected invert 1.0.0 to load, got %+v", s)
+			}
+		case "warhola-future", "warhola-broken", "warhola-shadow":
+			if s.Err == nil {
+				t.Errorf("expected %s to be skipped with an error", s.File)
+			}
+		default:
+			t.Errorf("unexpected plugin status %+v", s)
+		}
+	}
+	if len(l.Status()) != 4 {
+		t.Errorf("expected 4 plugin statuses, got %d", len(l.Status()))
+	}
+	cmds, _ := l.Get("ALL")
+	var invert flip.Command
+	for _, cmd := range cmds {
+		if cmd.Tag() == "invert" {
+			invert = cmd
+		}
+	}
+	if invert == nil {
+		t.Fatal("no invert command loaded")
+	}
+
+	cv, err := canvas.New(
+		canvas.SetColorModel("RGBA"),
+		canvas.SetPath("/tmp/test-warhola-exec-plugin.png", ""),
+		canvas.SetRect(3, 2),
+	)
+	if err != nil {
+		t.Fatalf("canvas error: %s", err)
+	}
+	cv.Adjust(func(color.RGBA) color.RGBA { return color.RGBA{200, 100, 0, 255} })
+	c := ctx.With(context.Background(), &ctx.Session{
+		Canvas: cv,
+		Logger: log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter()),
+	})
+	c, exit := invert.Execute(c, []string{"-amount", "200"})
+	if exit != flip.ExitSuccess {
+		t.Fatalf("invert exited with %v", exit)
+	}
+	rcv := ctx.Canvas(c)
+	if got := rcv.Bounds(); got != image.Rect(0, 0, 3, 2) {
+		t.Errorf("expected bounds %v, got %v", image.Rect(0, 0, 3, 2), got)
+	}
+	want := color.RGBA{0, 100, 200, 255}
+	if got := color.RGBAModel.Convert(rcv.At(2, 1)).(color.RGBA); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	e := &plugin.Envelope{Format: plugin.RawFormat, Width: 2, Height: 2, Stride: 8, Data: make([]byte, 12)}
+	if _, err := e.Image(); err == nil {
+		t.Error("expected an error for a short raw envelope")
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable plugin test script needs a posix shell")
+	}
+	dir, err := ioutil.TempDir("", "warhola-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "warhola-hang"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755)
+	defer func(d time.Duration) { plugin.ExecTimeout = d }(plugin.ExecTimeout)
+	plugin.ExecTimeout = 200 * time.Millisecond
+
+	l, _ := plugin.New(dir)
+	start := time.Now()
+	l.Load()
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected a hung plugin to be killed, loading took %s", time.Since(start))
+	}
+	st := l.Status()
+	if len(st) != 1 || st[0].Err == nil || !strings.Contains(st[0].Err.Error(), "did not answer") {
+		t.Errorf("expected the hung plugin to time out, got %+v", st)
+	}
+}
+
+func TestDirs(t *testing.T) {
+	defer os.Setenv(plugin.PathEnv, os.Getenv(plugin.PathEnv))
+	defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+
+	os.Setenv(plugin.PathEnv, "")
+	os.Setenv("XDG_DATA_HOME", "/tmp/xdg-data")
+	d := plugin.Dirs("a,b")
+	if d[0] != plugin.PluginsLocal || d[1] != "/tmp/xdg-data/warhola/plugins" || d[len(d)-2] != "a" || d[len(d)-1] != "b" {
+		t.Errorf("unexpected XDG plugin dirs %v", d)
+	}
+
+	os.Setenv(plugin.PathEnv, strings.Join([]string{"/x", "/y"}, string(os.PathListSeparator)))
+	d = plugin.Dirs("")
+	if len(d) != 3 || d[1] != "/x" || d[2] != "/y" {
+		t.Errorf("expected the %s dirs in place of the XDG dirs, got %v", plugin.PathEnv, d)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable plugin test script needs a posix shell")
+	}
+	dir, err := ioutil.TempDir("", "warhola-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeExecPlugin(t, dir, "invert")
+	writeExecPlugin(t, dir, "future")
+	cnf := filepath.Join(dir, "plugins.yaml")
+
+	if f, err := plugin.ReadFilter(filepath.Join(dir, "none.yaml")); err != nil || len(f.Allow)+len(f.Deny) != 0 {
+		t.Errorf("expected an empty filter for a missing configuration, got %v %v", f, err)
+	}
+	ioutil.WriteFile(cnf, []byte("allow: [\"[\"]\n"), 0644)
+	if _, err := plugin.ReadFilter(cnf); err == nil {
+		t.Error("expected an error for a bad pattern")
+	}
+	ioutil.WriteFile(cnf, []byte("deny: [warhola-fut*]\n"), 0644)
+	f, err := plugin.ReadFilter(cnf)
+	if err != nil {
+		t.Fatalf("read filter error: %s", err)
+	}
+
+	l, _ := plugin.New(dir, dir+"/.")
+	l.SetFilter(f)
+	if err := l.Load(); err != nil {
+		t.Fatalf("load error: %s", err)
+	}
+	st := l.Status()
+	if len(st) != 2 {
+		t.Fatalf("expected a status for each plugin of a single dir, got %v", st)
+	}
+	for _, s := range st {
+		switch {
+		case s.File == "future" && s.Err != plugin.DeniedError,
+			s.File == "invert" && s.Err != nil:
+			t.Errorf("unexpected status %+v", s)
+		}
+	}
+
+	if _, err := l.Get("invert", "sharpen", "emboss"); err == nil ||
+		!strings.Contains(err.Error(), "sharpen") || !strings.Contains(err.Error(), "emboss") {
+		t.Errorf("expected an error of every missing plugin, got %v", err)
+	}
+	if cmds, err := l.Get("invert", "resize"); err != nil || len(cmds) != 2 {
+		t.Errorf("expected the invert and resize commands, got %d, %v", len(cmds), err)
+	}
+}
@@ -0,0 +1,170 @@
+package pluginsdk
+
+import (
+	"context"
+	"os"
+
+	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/log"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/plugin"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+// A Command of a plugin: a tag, instruction and typed flags, with a body run
+// against the canvas of each invocation. A Go plugin exports it as
+//
+//	var invert = pluginsdk.New("invert", "Invert the colors of a canvas")
+//
+//	var amount = invert.Int("amount", 255, "The amount of inversion")
+//
+//	var Manifest = invert.Manifest("1.0.0", "Color inversion")
+//
+//	func Command() flip.Command { return invert.Command() }
+//
+//	func init() {
+//		invert.Run(func(cv canvas.Canvas) error {
+//			return cv.Adjust(...)
+//		})
+//	}
+//
+// The values of the flags are set for the duration of each invocation, as with
+// the flag package, from their defaults where not provided, and a Command is
+// not run by more than one goroutine at once.
+type Command struct {
+	Tag, Instruction string
+	Priority         int
+	flags            []func(*flip.FlagSet)
+	body             func(canvas.Canvas) error
+}
+
+// Provides a new Command of the provided tag and instruction.
+func New(tag, instruction string) *Command {
+	return &Command{Tag: tag, Instruction: instruction}
+}
+
+// Sets the body of the Command, run against the canvas of each invocation,
+// returning the Command.
+func (c *Command) Run(body func(canvas.Canvas) error) *Command {
+	c.body = body
+	return c
+}
+
+// Declares a string flag of the provided name, default value and usage,
+// providing the value of the flag.
+func (c *Command) String(name, value, usage string) *string {
+	p := new(string)
+	*p = value
+	c.flags = append(c.flags, func(fs *flip.FlagSet) { fs.StringVar(p, name, value, usage) })
+	return p
+}
+
+// Declares an int flag of the provided name, default value and usage,
+// providing the value of the flag.
+func (c *Command) Int(name string, value int, usage string) *int {
+	p := new(int)
+	*p = value
+	c.flags = append(c.flags, func(fs *flip.FlagSet) { fs.IntVar(p, name, value, usage) })
+	return p
+}
+
+// Declares a float64 flag of the provided name, default value and usage,
+// providing the value of the flag.
+func (c *Command) Float64(name string, value float64, usage string) *float64 {
+	p := new(float64)
+	*p = value
+	c.flags = append(c.flags, func(fs *flip.FlagSet) { fs.Float64Var(p, name, value, usage) })
+	return p
+}
+
+// Declares a bool flag of the provided name, default value and usage,
+// providing the value of the flag.
+func (c *Command) Bool(name string, value bool, usage string) *bool {
+	p := new(bool)
+	*p = value
+	c.flags = append(c.flags, func(fs *flip.FlagSet) { fs.BoolVar(p, name, value, usage) })
+	return p
+}
+
+// Provides a plugin Manifest of the Command tag and the provided version and
+// description, requiring the plugin API this package is built against.
+func (c *Command) Manifest(version, description string) plugin.Manifest {
+	return plugin.Manifest{
+		Name:        c.Tag,
+		Version:     version,
+		API:         plugin.APIVersion,
+		Description: description,
+	}
+}
+
+var (
+	NoCanvasError = xrr.Xrror("no canvas to run %s against").Out
+	NoBodyError   = xrr.Xrror("command %s has no body").Out
+)
+
+// Provides the flip.Command of the Command, as warhola expects of a plugin.
+func (c *Command) Command() flip.Command {
+	return c.command(nil)
+}
+
+// command provides the flip.Command of the Command, setting errp to any error
+// of the body where provided.
+func (c *Command) command(errp *error) flip.Command {
+	fs := flip.NewFlagSet(c.Tag, flip.ContinueOnError)
+	for _, fn := range c.flags {
+		fn(fs)
+	}
+	return flip.NewCommand(
+		"",
+		c.Tag,
+		c.Instruction,
+		c.Priority,
+		false,
+		func(x context.Context, a []string) (context.Context, flip.ExitStatus) {
+			cv := ctx.Canvas(x)
+			err := c.run(cv)
+			if errp != nil {
+				*errp = err
+			}
+			if err != nil {
+				if l := ctx.Log(x); l != nil {
+					l.Println(err)
+				}
+				return x, flip.ExitFailure
+			}
+			return ctx.WithCanvas(x, cv), flip.ExitSuccess
+		},
+		fs,
+	)
+}
+
+func (c *Command) run(cv canvas.Canvas) error {
+	switch {
+	case cv == nil:
+		return NoCanvasError(c.Tag)
+	case c.body == nil:
+		return NoBodyError(c.Tag)
+	}
+	return c.body(cv)
+}
+
+var ExecError = xrr.Xrror("command %s exited with %v").Out
+
+// Runs the Command with the provided args against the canvas, as warhola
+// would, providing the resulting canvas and any error.
+func (c *Command) Exec(cv canvas.Canvas, args ...string) (canvas.Canvas, error) {
+	var err error
+	x := ctx.With(context.Background(), &ctx.Session{
+		Canvas: cv,
+		Logger: log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter()),
+	})
+	x, exit := c.command(&err).Execute(x, args)
+	if err != nil {
+		return cv, err
+	}
+	if exit != flip.ExitSuccess {
+		return cv, ExecError(c.Tag, exit)
+	}
+	return ctx.Canvas(x), nil
+}
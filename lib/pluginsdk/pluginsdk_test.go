@@ -0,0 +1,81 @@
+package pluginsdk_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/plugin"
+	"github.com/Laughs-In-Flowers/warhola/lib/pluginsdk"
+	"github.com/Laughs-In-Flowers/warhola/lib/pluginsdktest"
+)
+
+func gradient() image.Image {
+	i := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			i.SetNRGBA(x, y, color.NRGBA{uint8(x * 16), uint8(y * 32), 128, 255})
+		}
+	}
+	return i
+}
+
+func invert() (*pluginsdk.Command, *int, *bool) {
+	cmd := pluginsdk.New("invert", "Invert the colors of a canvas")
+	amount := cmd.Int("amount", 255, "The amount of inversion")
+	fail := cmd.Bool("fail", false, "Fail instead of inverting")
+	cmd.Run(func(cv canvas.Canvas) error {
+		if *fail {
+			return errors.New("failed as asked")
+		}
+		a := uint8(*amount)
+		inv := func(v uint8) uint8 {
+			if v > a {
+				return 0
+			}
+			return a - v
+		}
+		return cv.Adjust(func(c color.RGBA) color.RGBA {
+			return color.RGBA{inv(c.R), inv(c.G), inv(c.B), c.A}
+		})
+	})
+	return cmd, amount, fail
+}
+
+func TestCommand(t *testing.T) {
+	cmd, amount, _ := invert()
+
+	pluginsdktest.Test(t, cmd, gradient(), "testdata/invert_200.png", "-amount", "200")
+	if *amount != 200 {
+		t.Errorf("expected the amount flag to be 200, got %d", *amount)
+	}
+	pluginsdktest.Test(t, cmd, gradient(), "testdata/invert.png")
+	if *amount != 255 {
+		t.Errorf("expected the amount flag to return to its default 255, got %d", *amount)
+	}
+
+	cv, _ := canvas.FromImage(gradient())
+	if _, err := cmd.Exec(cv, "-fail"); err == nil || err.Error() != "failed as asked" {
+		t.Errorf("expected the error of the body, got %v", err)
+	}
+	cv, _ = canvas.FromImage(gradient())
+	if os.Getenv(pluginsdktest.UpdateEnv) == "" {
+		if err := pluginsdktest.Golden("testdata/invert.png", cv); err == nil {
+			t.Error("expected a golden image difference")
+		}
+	}
+	if err := cv.Save(); err != canvas.SaveMemoryError {
+		t.Errorf("expected an error saving a canvas held in memory, got %v", err)
+	}
+
+	m := cmd.Manifest("1.0.0", "Color inversion")
+	if m.Name != "invert" || m.API != plugin.APIVersion {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+	if c := cmd.Command(); c.Tag() != "invert" {
+		t.Errorf("expected an invert flip.Command, got %s", c.Tag())
+	}
+}
@@ -0,0 +1,94 @@
+package pluginsdktest
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/pluginsdk"
+	"github.com/Laughs-In-Flowers/xrr"
+)
+
+// The environment variable which, set, has Golden write golden images rather
+// than compare against them, e.g. WARHOLA_UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = "WARHOLA_UPDATE_GOLDEN"
+
+// Provides a new canvas of the image at path held in memory, and any error.
+func Open(path string) (canvas.Canvas, error) {
+	i, err := canvas.OpenTo(path)
+	if err != nil {
+		return nil, err
+	}
+	return canvas.FromImage(i)
+}
+
+var (
+	GoldenSizeError  = xrr.Xrror("golden image %s is %v, provided %v").Out
+	GoldenPixelError = xrr.Xrror("golden image %s is %v at %d,%d, provided %v").Out
+)
+
+func nrgba(i image.Image) *image.NRGBA {
+	b := i.Bounds()
+	n := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(n, n.Rect, i, b.Min, draw.Src)
+	return n
+}
+
+// Compares the image to the golden png image at path, providing an error of
+// the first difference. With UpdateEnv set the image is written to path.
+func Golden(path string, i image.Image) error {
+	n := nrgba(i)
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return png.Encode(f, n)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gi, err := png.Decode(f)
+	if err != nil {
+		return err
+	}
+	g := nrgba(gi)
+	if g.Rect != n.Rect {
+		return GoldenSizeError(path, g.Rect.Size(), n.Rect.Size())
+	}
+	for y := 0; y < n.Rect.Dy(); y++ {
+		for x := 0; x < n.Rect.Dx(); x++ {
+			if gc, nc := g.NRGBAAt(x, y), n.NRGBAAt(x, y); gc != nc {
+				return GoldenPixelError(path, gc, x, y, nc)
+			}
+		}
+	}
+	return nil
+}
+
+// Runs the provided Command with the provided args against an in memory canvas
+// of the in image, failing the test where it errors or where the result differs from
+// the golden png image at path.
+func Test(t testing.TB, c *pluginsdk.Command, in image.Image, golden string, args ...string) {
+	t.Helper()
+	cv, err := canvas.FromImage(in)
+	if err != nil {
+		t.Fatalf("%s canvas error: %s", c.Tag, err)
+	}
+	if cv, err = c.Exec(cv, args...); err != nil {
+		t.Fatalf("%s error: %s", c.Tag, err)
+	}
+	if err = Golden(golden, cv); err != nil {
+		t.Errorf("%s %v: %s", c.Tag, args, err)
+	}
+}
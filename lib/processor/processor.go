@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"context"
+	"os"
+
+	"github.com/Laughs-In-Flowers/log"
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/core"
+	"github.com/Laughs-In-Flowers/warhola/lib/plugin"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/geo"
+)
+
+// A Processor opens, transforms and saves canvases from library code. It owns
+// the logger, fonts, plugins and defaults it uses, holds no package level
+// state, and is safe for use by any number of goroutines at once.
+type Processor struct {
+	log.Logger
+	fonts        *core.Fonts
+	plugins      plugin.Loader
+	pluginDirs   []string
+	pluginFilter *plugin.Filter
+	geometry     *geo.Geometry
+	canvas       []canvas.Config
+}
+
+// A Config function setting up a Processor.
+type Config func(*Processor) error
+
+// Provides a new Processor with the provided Config, and any error.
+func New(cnf ...Config) (*Processor, error) {
+	p := &Processor{
+		Logger:   log.New(os.Stdout, log.LInfo, log.DefaultNullFormatter()),
+		fonts:    core.NewCoreFonts(),
+		geometry: geo.New(""),
+	}
+	for _, c := range cnf {
+		if err := c(p); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.loadPlugins(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadPlugins loads the core commands and the plugins of the plugin
+// directories allowed by the plugin Filter. Plugins unable to load are skipped,
+// as reported by the Status of the plugin Loader.
+func (p *Processor) loadPlugins() error {
+	l, err := plugin.New(p.pluginDirs...)
+	if err != nil {
+		return err
+	}
+	if p.pluginFilter != nil {
+		l.SetFilter(p.pluginFilter)
+	}
+	if err = l.Load(); err != nil {
+		return err
+	}
+	p.plugins = l
+	return nil
+}
+
+// Set the logger of the Processor and the canvases it opens.
+func SetLogger(l log.Logger) Config {
+	return func(p *Processor) error {
+		p.Logger = l
+		return nil
+	}
+}
+
+// Add the fonts in the provided directories to the fonts of the Processor.
+func SetFontDirs(dirs ...string) Config {
+	return func(p *Processor) error {
+		return p.fonts.SetDir(dirs...)
+	}
+}
+
+// Load the plugins of the provided directories alongside the core commands.
+func SetPluginDirs(dirs ...string) Config {
+	return func(p *Processor) error {
+		p.pluginDirs = append(p.pluginDirs, dirs...)
+		return nil
+	}
+}
+
+// Load only the plugins allowed by the provided Filter.
+func SetPluginFilter(f *plugin.Filter) Config {
+	return func(p *Processor) error {
+		p.pluginFilter = f
+		return nil
+	}
+}
+
+// Set the default geometry of the Processor, used by any command given no
+// geometry of its own.
+func SetGeometry(g string) Config {
+	return func(p *Processor) error {
+		var err error
+		p.geometry, err = geo.Parse(g)
+		return err
+	}
+}
+
+// Set canvas Config applied to every canvas the Processor opens, ahead of any
+// Config provided to Open.
+func SetCanvas(cnf ...canvas.Config) Config {
+	return func(p *Processor) error {
+		p.canvas = append(p.canvas, cnf...)
+		return nil
+	}
+}
+
+// The fonts of the Processor.
+func (p *Processor) Fonts() *core.Fonts {
+	return p.fonts
+}
+
+// The plugin Loader of the Processor.
+func (p *Processor) Plugins() plugin.Loader {
+	return p.plugins
+}
+
+// Provides new core Options with the logger, fonts and default geometry of the
+// Processor.
+func (p *Processor) Options() *core.Options {
+	o := core.NewOptions(p.Logger, p.fonts)
+	o.SetString("default.geometry", p.geometry.Raw)
+	return o
+}
+
+// Provides a context holding the logger, plugins and default geometry of the
+// Processor along with the provided canvas, as core and plugin commands expect.
+func (p *Processor) Context(cv canvas.Canvas) context.Context {
+	return ctx.With(context.Background(), &ctx.Session{
+		Canvas:   cv,
+		Logger:   p.Logger,
+		Geometry: p.geometry,
+		Plugins:  p.plugins,
+	})
+}
+
+// Open a canvas from the in path, or a new canvas where none exists, to be
+// saved to the out path where provided. The provided Config take precedence
+// over any Config of the Processor with the same order.
+func (p *Processor) Open(in, out string, cnf ...canvas.Config) (canvas.Canvas, error) {
+	var c []canvas.Config
+	c = append(c, canvas.SetLogger(p.Logger), canvas.SetColorModel(canvas.WorkingColorModelString))
+	c = append(c, p.canvas...)
+	c = append(c, canvas.SetPath(in, out))
+	c = append(c, cnf...)
+	return canvas.New(c...)
+}
+
+// Validate and run the recipe against the provided canvas, providing the
+// resulting canvas and any error.
+func (p *Processor) Run(cv canvas.Canvas, r *core.Recipe) (canvas.Canvas, error) {
+	if err := r.Validate(); err != nil {
+		return cv, err
+	}
+	c, err := r.Run(p.Context(cv), p.Options())
+	if rcv := ctx.Canvas(c); rcv != nil {
+		cv = rcv
+	}
+	return cv, err
+}
+
+// Open the in path, run the recipe against it and save it to the out path, or
+// over the in path where no out path is provided.
+func (p *Processor) Process(in, out string, r *core.Recipe, cnf ...canvas.Config) error {
+	cv, err := p.Open(in, out, cnf...)
+	if err != nil {
+		return err
+	}
+	if cv, err = p.Run(cv, r); err != nil {
+		return err
+	}
+	return cv.Save()
+}
@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/core"
+)
+
+func TestProcessor(t *testing.T) {
+	p, err := New(SetGeometry("20x10!"), SetCanvas(canvas.SetRect(40, 40)))
+	if err != nil {
+		t.Fatalf("processor error: %s", err)
+	}
+	r, err := core.ParseRecipe([]byte("steps:\n  - command: resize\n  - command: adjust\n    options:\n      brightness: 20\n"), ".yaml")
+	if err != nil {
+		t.Fatalf("recipe error: %s", err)
+	}
+
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	cvs := make([]canvas.Canvas, 8)
+	errs := make([]error, len(cvs))
+	for i := range cvs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cv, err := p.Open(filepath.Join(dir, fmt.Sprintf("%d.png", i)), "", canvas.SetColorModel("RGBA"))
+			if err == nil {
+				cvs[i], err = p.Run(cv, r)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for i, cv := range cvs {
+		if errs[i] != nil {
+			t.Fatalf("canvas %d error: %s", i, errs[i])
+		}
+		if got := cv.Bounds(); got != image.Rect(0, 0, 20, 10) {
+			t.Errorf("canvas %d: expected %v, got %v", i, image.Rect(0, 0, 20, 10), got)
+		}
+		if got := cv.Path(); got != filepath.Join(dir, fmt.Sprintf("%d.png", i)) {
+			t.Errorf("canvas %d: expected its own path, got %s", i, got)
+		}
+	}
+
+	if err := p.Process(filepath.Join(dir, "in.png"), filepath.Join(dir, "out.png"), r); err != nil {
+		t.Fatalf("process error: %s", err)
+	}
+	cv, err := p.Open(filepath.Join(dir, "out.png"), "")
+	if err != nil {
+		t.Fatalf("open processed error: %s", err)
+	}
+	if got := cv.Bounds(); got != image.Rect(0, 0, 20, 10) {
+		t.Errorf("processed: expected %v, got %v", image.Rect(0, 0, 20, 10), got)
+	}
+}
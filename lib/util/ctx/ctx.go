@@ -5,45 +5,103 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Laughs-In-Flowers/flip"
 	"github.com/Laughs-In-Flowers/log"
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
+	"github.com/Laughs-In-Flowers/warhola/lib/util/geo"
 )
 
-type Ctx struct {
-	canvas.Canvas
-	log.Logger
+// key is the unexported type of the context keys of this package, so that no
+// other package may read or replace its values but through its functions.
+type key int
+
+const sessionKey key = 0
+
+// The plugin commands available to a Session, as provided by a plugin Loader.
+type PluginLoader interface {
+	Plugins() (map[string][]string, error)
+	Get(...string) ([]flip.Command, error)
+}
+
+// A Session holds every value a warhola invocation passes through a context
+// to the commands it runs.
+type Session struct {
+	Canvas   canvas.Canvas
+	Logger   log.Logger
+	Geometry *geo.Geometry
+	Plugins  PluginLoader
 	Debug    bool
 	DebugMap map[string]string
 	File     string
-	Geometry string
-}
-
-func Is(c context.Context) *Ctx {
-	cv := Canvas(c)
-	l := Log(c)
-	d := Debug(c)
-	dm := DebugMap(c)
-	f := File(c)
-	g := Geometry(c)
-	return &Ctx{
-		cv, l, d, dm, f, g,
+}
+
+func session(c context.Context) *Session {
+	if s, ok := c.Value(sessionKey).(*Session); ok {
+		return s
 	}
+	return &Session{}
+}
+
+// Provides a copy of the Session of the provided context, a zero Session where
+// the context has none.
+func Is(c context.Context) *Session {
+	s := *session(c)
+	return &s
+}
+
+// Provides a context holding a copy of the provided Session.
+func With(c context.Context, s *Session) context.Context {
+	ns := *s
+	return context.WithValue(c, sessionKey, &ns)
+}
+
+func with(c context.Context, fn func(*Session)) context.Context {
+	s := Is(c)
+	fn(s)
+	return context.WithValue(c, sessionKey, s)
+}
+
+// Provides a context holding the provided canvas.
+func WithCanvas(c context.Context, cv canvas.Canvas) context.Context {
+	return with(c, func(s *Session) { s.Canvas = cv })
+}
+
+// Provides a context holding the provided logger.
+func WithLog(c context.Context, l log.Logger) context.Context {
+	return with(c, func(s *Session) { s.Logger = l })
+}
+
+// Provides a context holding the provided geometry.
+func WithGeometry(c context.Context, g *geo.Geometry) context.Context {
+	return with(c, func(s *Session) { s.Geometry = g })
+}
+
+// Provides a context holding the provided plugins.
+func WithPlugins(c context.Context, p PluginLoader) context.Context {
+	return with(c, func(s *Session) { s.Plugins = p })
+}
+
+// Provides a context holding the provided debug status.
+func WithDebug(c context.Context, d bool) context.Context {
+	return with(c, func(s *Session) { s.Debug = d })
+}
+
+// Provides a context holding the provided debug information.
+func WithDebugMap(c context.Context, m map[string]string) context.Context {
+	return with(c, func(s *Session) { s.DebugMap = m })
+}
+
+// Provides a context holding the provided file path.
+func WithFile(c context.Context, f string) context.Context {
+	return with(c, func(s *Session) { s.File = f })
 }
 
 func Debug(c context.Context) bool {
-	dv := c.Value(0)
-	if d, ok := dv.(bool); ok {
-		return d
-	}
-	return false
+	return session(c).Debug
 }
 
 func DebugMap(c context.Context) map[string]string {
-	di := c.Value(1)
-	if div, ok := di.(map[string]string); ok {
-		return div
-	}
-	return nil
+	return session(c).DebugMap
 }
 
 func DebugMapCollapse(m map[string]string) string {
@@ -55,37 +113,21 @@ func DebugMapCollapse(m map[string]string) string {
 }
 
 func Log(c context.Context) log.Logger {
-	l := c.Value(2)
-	var ll log.Logger
-	var ok bool
-	if ll, ok = l.(log.Logger); ok {
-		return ll
-	}
-	return nil
+	return session(c).Logger
 }
 
 func Canvas(c context.Context) canvas.Canvas {
-	cv := c.Value(4)
-	var cvv canvas.Canvas
-	var ok bool
-	if cvv, ok = cv.(canvas.Canvas); ok {
-		return cvv
-	}
-	return nil
+	return session(c).Canvas
+}
+
+func Plugins(c context.Context) PluginLoader {
+	return session(c).Plugins
 }
 
 func File(c context.Context) string {
-	f := c.Value(3)
-	if ff, ok := f.(string); ok {
-		return ff
-	}
-	return ""
+	return session(c).File
 }
 
-func Geometry(c context.Context) string {
-	g := c.Value(4)
-	if gg, ok := g.(string); ok {
-		return gg
-	}
-	return ""
+func Geometry(c context.Context) *geo.Geometry {
+	return session(c).Geometry
 }
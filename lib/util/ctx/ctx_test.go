@@ -0,0 +1,43 @@
+package ctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Laughs-In-Flowers/warhola/lib/util/geo"
+)
+
+func TestSession(t *testing.T) {
+	g := geo.New("10x10")
+	c := WithGeometry(context.Background(), g)
+	c = WithFile(c, "file.png")
+	c = WithDebug(c, true)
+	c = context.WithValue(c, 4, "not a canvas")
+	c = context.WithValue(c, 0, false)
+
+	if got := Geometry(c); got != g {
+		t.Errorf("geometry: expected %v, got %v", g, got)
+	}
+	if got := File(c); got != "file.png" {
+		t.Errorf("file: expected file.png, got %s", got)
+	}
+	if !Debug(c) {
+		t.Error("debug: expected true, got false")
+	}
+	if Canvas(c) != nil || Plugins(c) != nil || Log(c) != nil {
+		t.Error("expected unset values to be nil")
+	}
+
+	s := Is(c)
+	s.File = "other.png"
+	if got := File(c); got != "file.png" {
+		t.Errorf("session copy: expected file.png, got %s", got)
+	}
+	b := WithFile(c, "changed.png")
+	if File(c) != "file.png" || File(b) != "changed.png" {
+		t.Errorf("with: expected the parent context unchanged, got %s and %s", File(c), File(b))
+	}
+	if got := File(With(context.Background(), s)); got != "other.png" {
+		t.Errorf("with session: expected other.png, got %s", got)
+	}
+}
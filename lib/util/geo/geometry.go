@@ -1,6 +1,8 @@
 package geo
 
 import (
+	"image"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -10,6 +12,12 @@ import (
 	"github.com/Laughs-In-Flowers/xrr"
 )
 
+// A Geometry parsed from an ImageMagick geometry string, i.e. 800x600+10+20,
+// 50%, 800x600^, 800x600!, 800x600>, 800x600<, 480000@, along with the
+// space separated forms of width:800 height:600 offset:10,20 {10/20},
+// rect:10,20,810,620, 4:3 and a gravity name. Sizes and offsets may be given in
+// cm, mm, in or pt, i.e. 10cmx15cm+5mm+5mm or 4inx6in@300dpi, and are in
+// pixels once the Geometry is resolved with Resolve.
 type Geometry struct {
 	Raw              string
 	ScaleX, ScaleY   float64
@@ -18,9 +26,94 @@ type Geometry struct {
 	AspectX, AspectY float64
 	Area             int
 	Gravity          Gravity
+	Fill             bool
+	Force            bool
+	Shrink           bool
+	Enlarge          bool
+	DPI              float64
 	Error            []error
+	rect             bool
+	lengths          [4]length
 }
 
+// A length of a geometry value in a physical unit.
+type length struct {
+	value float64
+	unit  string
+}
+
+const (
+	lengthX = iota
+	lengthY
+	lengthOffsetX
+	lengthOffsetY
+)
+
+func (g *Geometry) field(i int) *int {
+	switch i {
+	case lengthX:
+		return &g.X
+	case lengthY:
+		return &g.Y
+	case lengthOffsetX:
+		return &g.OffsetX
+	}
+	return &g.OffsetY
+}
+
+// Whether the Geometry holds any size or offset in a physical unit.
+func (g *Geometry) Physical() bool {
+	for _, l := range g.lengths {
+		if l.unit != "" {
+			return true
+		}
+	}
+	return false
+}
+
+var unresolvedError = xrr.Xrror("no resolution to resolve %v%s to pixels").Out
+
+// Resolve sets any size or offset given in a physical unit to pixels, by the
+// DPI of the Geometry where given, otherwise by the provided function giving
+// the points per unit of inch, cm or mm, i.e. the PP of a canvas Measure.
+func (g *Geometry) Resolve(pp func(string) float64) error {
+	if g.DPI > 0 {
+		dpi := g.DPI
+		pp = func(u string) float64 {
+			switch u {
+			case "cm":
+				return dpi / 2.54
+			case "mm":
+				return dpi / 25.4
+			}
+			return dpi
+		}
+	}
+	for i, l := range g.lengths {
+		if l.unit == "" {
+			continue
+		}
+		var ppu float64
+		switch l.unit {
+		case "px":
+			ppu = 1
+		case "pt":
+			ppu = pp("inch") / 72
+		case "in":
+			ppu = pp("inch")
+		default:
+			ppu = pp(l.unit)
+		}
+		if ppu <= 0 {
+			return unresolvedError(l.value, l.unit)
+		}
+		*g.field(i) = int(math.Floor(l.value*ppu + 0.5))
+	}
+	return nil
+}
+
+// Provides a Geometry from the provided string, with any parse errors held in
+// the Geometry Error field.
 func New(s string) *Geometry {
 	g := defaultGeometry()
 	if s != "" {
@@ -29,23 +122,66 @@ func New(s string) *Geometry {
 	return g
 }
 
+// Parses the provided string to a Geometry, returning an error for any
+// malformed geometry.
+func Parse(s string) (*Geometry, error) {
+	g := New(s)
+	return g, g.Err()
+}
+
+// The parse error of the Geometry, nil where the Geometry is well formed.
+func (g *Geometry) Err() error {
+	if len(g.Error) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, err := range g.Error {
+		msgs = append(msgs, err.Error())
+	}
+	return geometryError(strings.Join(msgs, "; "))
+}
+
 func defaultGeometry() *Geometry {
-	return &Geometry{"", 0, 0, 0, 0, 0, 0, 1, 1, 0, Center, make([]error, 0)}
+	return &Geometry{
+		AspectX: 1,
+		AspectY: 1,
+		Gravity: NorthWest,
+		Error:   make([]error, 0),
+	}
 }
 
+var (
+	braceRx = regexp.MustCompile("[{][^}]*[}]")
+	dpiRx   = regexp.MustCompile("(?i)@?([0-9]*\\.?[0-9]+)dpi\\b")
+)
+
 func parseGeometry(s string, g *Geometry) *Geometry {
 	g.Raw = s
-	for _, v := range grxs {
-		if v.MatchString(s) {
-			err := v.call(s, g)
-			if err != nil {
-				g.Error = append(g.Error, parseGeometryError(s, err))
-			}
+	ds := s
+	if m := dpiRx.FindStringSubmatch(s); m != nil {
+		g.DPI, _ = strconv.ParseFloat(m[1], 64)
+		if g.DPI <= 0 {
+			g.Error = append(g.Error, parseGeometryError(s, dpiError(m[0])))
+		}
+		ds = dpiRx.ReplaceAllString(s, " ")
+	}
+	for _, t := range strings.Fields(braceRx.ReplaceAllString(ds, " $0 ")) {
+		if err := parseToken(t, g); err != nil {
+			g.Error = append(g.Error, parseGeometryError(s, err))
 		}
 	}
 	return g
 }
 
+func parseToken(t string, g *Geometry) error {
+	for _, v := range grxs {
+		if v.MatchString(t) {
+			return v.call(t, g)
+		}
+	}
+	return malformedError(t)
+}
+
 type rx2geo func(*regexp.Regexp, string, *Geometry) error
 
 type grx struct {
@@ -68,16 +204,23 @@ func (g grx) call(s string, gg *Geometry) error {
 	return emptyRxError(s)
 }
 
-func paramsInt(r *regexp.Regexp, s string) (map[string]int, error) {
-	ret := make(map[string]int)
+func params(r *regexp.Regexp, s string) map[string]string {
+	ret := make(map[string]string)
 	match := r.FindStringSubmatch(s)
 	for i, name := range r.SubexpNames() {
-		if i > 0 && i <= len(match) {
-			v, err := strconv.Atoi(match[i])
-			if err == nil {
-				ret[name] = v
-			}
+		if i > 0 && i < len(match) && match[i] != "" {
+			ret[name] = match[i]
+		}
+	}
+	return ret
+}
 
+func paramsInt(r *regexp.Regexp, s string) (map[string]int, error) {
+	ret := make(map[string]int)
+	for k, m := range params(r, s) {
+		v, err := strconv.Atoi(m)
+		if err == nil {
+			ret[k] = v
 		}
 	}
 	return ret, nil
@@ -85,34 +228,16 @@ func paramsInt(r *regexp.Regexp, s string) (map[string]int, error) {
 
 func paramsFloat(r *regexp.Regexp, s string) (map[string]float64, error) {
 	ret := make(map[string]float64)
-	match := r.FindStringSubmatch(s)
-	for i, name := range r.SubexpNames() {
-		if i > 0 && i <= len(match) {
-			v, err := strconv.ParseFloat(match[i], 64)
-			if err == nil {
-				ret[name] = v
-			}
+	for k, m := range params(r, s) {
+		v, err := strconv.ParseFloat(m, 64)
+		if err == nil {
+			ret[k] = v
 		}
 	}
 	return ret, nil
 }
 
 var (
-	area = newGrx(
-		func(r *regexp.Regexp, s string, g *Geometry) error {
-			vals, err := paramsInt(r, s)
-			if err != nil {
-				return err
-			}
-			var ok bool
-			if g.Area, ok = vals["area"]; !ok {
-				return emptyRxError(s)
-			}
-			return nil
-		},
-		regexp.MustCompile("(?P<area>[0-9]+)[@]"),
-	)
-
 	aspect = newGrx(
 		func(r *regexp.Regexp, s string, g *Geometry) error {
 			vals, err := paramsFloat(r, s)
@@ -126,9 +251,12 @@ var (
 			if g.AspectY, ok = vals["aspectY"]; !ok {
 				return emptyRxError(s)
 			}
+			if g.AspectX == 0 || g.AspectY == 0 {
+				return aspectError(s)
+			}
 			return nil
 		},
-		regexp.MustCompile("(?P<aspectX>[0-9]*\\.?[0-9]+)[:](?P<aspectY>[0-9]*\\.?[0-9]+)"),
+		regexp.MustCompile("\\A(?P<aspectX>[0-9]*\\.?[0-9]+)[:](?P<aspectY>[0-9]*\\.?[0-9]+)\\z"),
 	)
 
 	gravityError = xrr.Xrror("%s is not a gravity specification").Out
@@ -142,7 +270,7 @@ var (
 			}
 			return err
 		},
-		regexp.MustCompile("(?i)(?P<gravity>NorthWest|NorthEast|North|West|Center|East|SouthWest|SouthEast|South)"),
+		regexp.MustCompile("(?i)\\A(?P<gravity>NorthWest|NorthEast|North|West|Center|East|SouthWest|SouthEast|South)\\z"),
 	)
 
 	height = newGrx(
@@ -157,7 +285,7 @@ var (
 			}
 			return nil
 		},
-		regexp.MustCompile("(?i)(height|y)[:](?P<y>[0-9]+)"),
+		regexp.MustCompile("(?i)\\A(height|y)[:](?P<y>[0-9]+)\\z"),
 	)
 
 	offsetrx2geo = func(r *regexp.Regexp, s string, g *Geometry) error {
@@ -177,12 +305,12 @@ var (
 
 	offset1 = newGrx(
 		offsetrx2geo,
-		regexp.MustCompile("[{](?P<offsetX>[+|-]?[0-9]+)[/](?P<offsetY>[+|-]?[0-9]+)[}]"),
+		regexp.MustCompile("\\A[{](?P<offsetX>[+-]?[0-9]+)[/](?P<offsetY>[+-]?[0-9]+)[}]\\z"),
 	)
 
 	offset2 = newGrx(
 		offsetrx2geo,
-		regexp.MustCompile("(?i)(offset)[:](?P<offsetX>[+|-]?[0-9]+)[,](?P<offsetY>[+|-]?[0-9]+)"),
+		regexp.MustCompile("(?i)\\A(offset)[:](?P<offsetX>[+-]?[0-9]+)[,](?P<offsetY>[+-]?[0-9]+)\\z"),
 	)
 
 	rect = newGrx(
@@ -204,26 +332,13 @@ var (
 			if g.Y, ok = vals["maxY"]; !ok {
 				return emptyRxError(s)
 			}
-			return nil
-		},
-		regexp.MustCompile("(?i)((rect)[:]|\\A)(?P<rect>(?P<minX>[0-9]+),(?P<minY>[0-9]+),(?P<maxX>[0-9]+),(?P<maxY>[0-9]+))"),
-	)
-
-	scale = newGrx(
-		func(r *regexp.Regexp, s string, g *Geometry) error {
-			vals, err := paramsFloat(r, s)
-			if err != nil {
-				return err
-			}
-			var sc float64
-			var ok bool
-			if sc, ok = vals["scale"]; !ok {
-				return emptyRxError(s)
+			if g.X < g.OffsetX || g.Y < g.OffsetY {
+				return rectError(s)
 			}
-			g.ScaleX, g.ScaleY = sc, sc
+			g.rect = true
 			return nil
 		},
-		regexp.MustCompile("(?P<scale>[-]?[0-9]+)[%]"),
+		regexp.MustCompile("(?i)\\A((rect)[:])?(?P<rect>(?P<minX>[0-9]+),(?P<minY>[0-9]+),(?P<maxX>[0-9]+),(?P<maxY>[0-9]+))\\z"),
 	)
 
 	sxs = newGrx(
@@ -242,10 +357,10 @@ var (
 			return nil
 
 		},
-		regexp.MustCompile("(?P<scaleX>[0-9]+)[%](?P<scaleY>[0-9]+)"),
+		regexp.MustCompile("\\A(?P<scaleX>[0-9]+)[%](?P<scaleY>[0-9]+)\\z"),
 	)
 
-	wxh = newGrx(
+	width = newGrx(
 		func(r *regexp.Regexp, s string, g *Geometry) error {
 			vals, err := paramsInt(r, s)
 			if err != nil {
@@ -255,34 +370,229 @@ var (
 			if g.X, ok = vals["x"]; !ok {
 				return emptyRxError(s)
 			}
-			if g.Y, ok = vals["y"]; !ok {
-				return emptyRxError(s)
-			}
 			return nil
 		},
-		regexp.MustCompile("(?P<x>[0-9]+)[x](?P<y>[0-9]+)"),
+		regexp.MustCompile("(?i)\\A(width|x):(?P<x>[0-9]+)\\z"),
 	)
 
-	width = newGrx(
+	// The ImageMagick geometry form of
+	// [width][%][x[height][%]][@][flags][{+-}x{+-}y][flags], where flags are
+	// any of %, !, ^, < and >.
+	magick = newGrx(
 		func(r *regexp.Regexp, s string, g *Geometry) error {
-			vals, err := paramsInt(r, s)
-			if err != nil {
+			p := params(r, s)
+			flags := p["wp"] + p["hp"] + p["flags"] + p["after"]
+			if p["w"] == "" && p["h"] == "" && p["ox"] == "" {
+				return malformedError(s)
+			}
+			if strings.Contains(flags, "@") {
+				return parseArea(s, p, g)
+			}
+			if strings.Contains(flags, "%") {
+				return parseScale(s, p, g)
+			}
+			var err error
+			if err = g.dimension(s, lengthX, p["w"], p["wu"]); err != nil {
 				return err
 			}
-			var ok bool
-			if g.X, ok = vals["x"]; !ok {
-				return emptyRxError(s)
+			if err = g.dimension(s, lengthY, p["h"], p["hu"]); err != nil {
+				return err
+			}
+			if err = parseOffset(s, p, g); err != nil {
+				return err
+			}
+			g.Fill = strings.Contains(flags, "^")
+			g.Force = strings.Contains(flags, "!")
+			g.Shrink = strings.Contains(flags, ">")
+			g.Enlarge = strings.Contains(flags, "<")
+			if g.Shrink && g.Enlarge {
+				return flagsError(s)
 			}
 			return nil
 		},
-		regexp.MustCompile("(?i)(width|x):(?P<x>[0-9]+)"),
+		regexp.MustCompile(
+			"\\A(?P<w>[0-9]*\\.?[0-9]+)?(?P<wu>"+units+")?(?P<wp>%)?"+
+				"(?:[xX](?P<h>[0-9]*\\.?[0-9]+)?(?P<hu>"+units+")?(?P<hp>%)?)?"+
+				"(?P<flags>[%!^<>@]*)"+
+				"(?P<ox>[+-][0-9]*\\.?[0-9]+)?(?P<oxu>"+units+")?"+
+				"(?P<oy>[+-][0-9]*\\.?[0-9]+)?(?P<oyu>"+units+")?"+
+				"(?P<after>[%!^<>@]*)\\z",
+		),
 	)
 
-	grxs = []grx{area, aspect, gravity, height, offset1, offset2, rect, scale, sxs, wxh, width}
+	units = "(?i:cm|mm|in|pt|px)"
+
+	grxs = []grx{aspect, gravity, height, offset1, offset2, rect, sxs, width, magick}
 
 	parseGeometryError = xrr.Xrror("error parsing '%s' as Geometry: %s").Out
+	geometryError      = xrr.Xrror("%s").Out
+	malformedError     = xrr.Xrror("'%s' is not a geometry").Out
+	dimensionError     = xrr.Xrror("'%s' has a fractional size without %%").Out
+	aspectError        = xrr.Xrror("'%s' is not an aspect ratio").Out
+	rectError          = xrr.Xrror("'%s' has a maximum point before its minimum point").Out
+	flagsError         = xrr.Xrror("'%s' can not both shrink and enlarge only").Out
+	unitError          = xrr.Xrror("'%s' has a unit on a percent or area").Out
+	dpiError           = xrr.Xrror("'%s' is not a resolution").Out
 )
 
+// dimension sets the geometry value at i from v, held as a length where v has
+// a unit, otherwise as a whole number of pixels.
+func (g *Geometry) dimension(s string, i int, v, unit string) error {
+	if v == "" {
+		return nil
+	}
+	if unit != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return malformedError(s)
+		}
+		g.lengths[i] = length{f, strings.ToLower(unit)}
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(v, "+"))
+	if err != nil {
+		return dimensionError(s)
+	}
+	*g.field(i) = n
+	return nil
+}
+
+func hasUnit(p map[string]string) bool {
+	return p["wu"] != "" || p["hu"] != ""
+}
+
+func parseArea(s string, p map[string]string, g *Geometry) error {
+	if hasUnit(p) {
+		return unitError(s)
+	}
+	w, _ := strconv.ParseFloat(p["w"], 64)
+	a := w
+	if h, err := strconv.ParseFloat(p["h"], 64); err == nil {
+		a = w * h
+	}
+	if a <= 0 {
+		return malformedError(s)
+	}
+	g.Area = int(a)
+	g.Shrink = strings.Contains(p["flags"]+p["after"], ">")
+	g.Enlarge = strings.Contains(p["flags"]+p["after"], "<")
+	return parseOffset(s, p, g)
+}
+
+func parseScale(s string, p map[string]string, g *Geometry) error {
+	if hasUnit(p) {
+		return unitError(s)
+	}
+	if p["w"] == "" && p["h"] == "" {
+		return malformedError(s)
+	}
+	var err error
+	if p["w"] != "" {
+		if g.ScaleX, err = strconv.ParseFloat(p["w"], 64); err != nil {
+			return malformedError(s)
+		}
+	}
+	g.ScaleY = g.ScaleX
+	if p["h"] != "" {
+		if g.ScaleY, err = strconv.ParseFloat(p["h"], 64); err != nil {
+			return malformedError(s)
+		}
+		if p["w"] == "" {
+			g.ScaleX = g.ScaleY
+		}
+	}
+	flags := p["flags"] + p["after"]
+	g.Shrink = strings.Contains(flags, ">")
+	g.Enlarge = strings.Contains(flags, "<")
+	return parseOffset(s, p, g)
+}
+
+func parseOffset(s string, p map[string]string, g *Geometry) error {
+	if err := g.dimension(s, lengthOffsetX, p["ox"], p["oxu"]); err != nil {
+		return err
+	}
+	return g.dimension(s, lengthOffsetY, p["oy"], p["oyu"])
+}
+
+// Size resolves the geometry against an image of width w and height h by the
+// ImageMagick resize rules: a width and height is the largest size keeping the
+// aspect of the image within them, or the smallest covering them with the ^
+// flag, or exactly them with the ! flag; a percent scales the image, an area
+// is the size keeping the aspect with at most that many pixels, and the > and
+// < flags only shrink or enlarge the image.
+func (g *Geometry) Size(w, h int) (int, int) {
+	if w <= 0 || h <= 0 {
+		return g.X, g.Y
+	}
+	fw, fh := float64(w), float64(h)
+	var sx, sy float64
+	switch {
+	case g.ScaleX > 0 || g.ScaleY > 0:
+		sx, sy = g.ScaleX/100, g.ScaleY/100
+	case g.Area > 0:
+		sx = math.Sqrt(float64(g.Area) / (fw * fh))
+		sy = sx
+	case g.X == 0 && g.Y == 0:
+		return w, h
+	default:
+		sx, sy = float64(g.X)/fw, float64(g.Y)/fh
+		switch {
+		case g.X == 0:
+			sx = sy
+		case g.Y == 0:
+			sy = sx
+		case g.Force:
+		case g.Fill:
+			sx = math.Max(sx, sy)
+			sy = sx
+		default:
+			sx = math.Min(sx, sy)
+			sy = sx
+		}
+	}
+	nw, nh := int(math.Max(1, math.Floor(fw*sx+0.5))), int(math.Max(1, math.Floor(fh*sy+0.5)))
+	switch {
+	case g.Shrink && (nw > w || nh > h), g.Enlarge && (nw < w || nh < h):
+		return w, h
+	}
+	return nw, nh
+}
+
+// Rect resolves the geometry as a region of the provided bounds: a width and
+// height, or a percent of the bounds, placed by the gravity and offset, or the
+// points of a rect: geometry. A missing width or height extends to the bounds.
+func (g *Geometry) Rect(b image.Rectangle) image.Rectangle {
+	if g.rect {
+		return image.Rect(g.OffsetX, g.OffsetY, g.X, g.Y)
+	}
+	var size image.Point
+	switch {
+	case g.ScaleX > 0 || g.ScaleY > 0:
+		size = image.Pt(
+			int(float64(b.Dx())*g.ScaleX/100+0.5),
+			int(float64(b.Dy())*g.ScaleY/100+0.5),
+		)
+	default:
+		size = image.Pt(g.X, g.Y)
+		if g.X == 0 {
+			size.X = b.Dx() - g.OffsetX
+		}
+		if g.Y == 0 {
+			size.Y = b.Dy() - g.OffsetY
+		}
+	}
+	min := g.Place(size, b)
+	return image.Rectangle{min, min.Add(size)}
+}
+
+// Place resolves the gravity and offset of the geometry for an object of the
+// provided size within the bounds, providing the minimum point of the object.
+func (g *Geometry) Place(size image.Point, b image.Rectangle) image.Point {
+	return g.Gravity.Place(size, b, image.Pt(g.OffsetX, g.OffsetY))
+}
+
+// The edge or corner of the bounds an object is placed against, where an
+// offset moves the object in from that edge or corner.
 type Gravity int
 
 func stringToGravity(s string) Gravity {
@@ -322,6 +632,25 @@ const (
 	SouthEast
 )
 
+// Place provides the minimum point of an object of the provided size within
+// the bounds, placed against the gravity edge and moved in by the offset.
+func (gr Gravity) Place(size image.Point, b image.Rectangle, off image.Point) image.Point {
+	x, y := b.Min.X+off.X, b.Min.Y+off.Y
+	switch gr {
+	case North, Center, South:
+		x = b.Min.X + (b.Dx()-size.X)/2 + off.X
+	case NorthEast, East, SouthEast:
+		x = b.Max.X - size.X - off.X
+	}
+	switch gr {
+	case West, Center, East:
+		y = b.Min.Y + (b.Dy()-size.Y)/2 + off.Y
+	case SouthWest, South, SouthEast:
+		y = b.Max.Y - size.Y - off.Y
+	}
+	return image.Pt(x, y)
+}
+
 func GeometryFlag(fs *flip.FlagSet, val *string, dflt string) {
 	fs.StringVar(val, "geometry", dflt, GeometryInstruction)
 }
@@ -330,4 +659,4 @@ func GeometryVectorFlag(fs *flip.FlagSet, v *data.Vector, key string) {
 	fs.StringVectorVar(v, "geometry", key, "", GeometryInstruction)
 }
 
-var GeometryInstruction string = "set geometry by string"
+var GeometryInstruction string = "set geometry by an ImageMagick geometry string, i.e. 800x600+10+20, 50%, 800x600^, 800x600!, 800x600>, 800x600<, 480000@, with any size or offset in cm, mm, in or pt, i.e. 10cmx15cm+5mm+5mm or 4inx6in@300dpi"
@@ -1,6 +1,7 @@
 package geo
 
 import (
+	"image"
 	"reflect"
 	"testing"
 )
@@ -62,6 +63,143 @@ var expected = []expect{
 		check{"X", 500},
 		check{"Y", 900},
 	),
+	newExpect("magick", "800x600+10+20",
+		check{"X", 800},
+		check{"Y", 600},
+		check{"OffsetX", 10},
+		check{"OffsetY", 20},
+	),
+	newExpect("magick", "800x600-10-20", check{"OffsetX", -10}, check{"OffsetY", -20}),
+	newExpect("magick", "800", check{"X", 800}, check{"Y", 0}),
+	newExpect("magick", "x600", check{"X", 0}, check{"Y", 600}),
+	newExpect("magick", "50%", check{"ScaleX", 50.0}, check{"ScaleY", 50.0}),
+	newExpect("magick", "50x25%", check{"ScaleX", 50.0}, check{"ScaleY", 25.0}),
+	newExpect("magick", "12.5%x25%", check{"ScaleX", 12.5}, check{"ScaleY", 25.0}),
+	newExpect("magick", "800x600^", check{"Fill", true}, check{"Force", false}),
+	newExpect("magick", "800x600!", check{"Force", true}),
+	newExpect("magick", "800x600>", check{"Shrink", true}),
+	newExpect("magick", "800x600<", check{"Enlarge", true}),
+	newExpect("magick", "400x300@", check{"Area", 120000}),
+	newExpect("magick", "800x600^+10+20", check{"Fill", true}, check{"OffsetX", 10}),
+	newExpect("magick", "800x600+10+20!", check{"Force", true}, check{"OffsetY", 20}),
+	newExpect("magick", "500x900{10/10}", check{"X", 500}, check{"OffsetX", 10}),
+	newExpect("magick+aspect+gravity", "800x600 16:9 south",
+		check{"X", 800},
+		check{"AspectX", 16.0},
+		check{"Gravity", South},
+	),
+}
+
+func TestGeometryMalformed(t *testing.T) {
+	for _, v := range []string{
+		"800y600", "x", "%", "-50%", "800x600><", "12.5x4", "abc", "10,20,5,5", "0:9", "800x600 width",
+	} {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("expected an error parsing '%s'", v)
+		}
+	}
+}
+
+func TestGeometrySize(t *testing.T) {
+	for _, v := range []struct {
+		g          string
+		w, h       int
+		expW, expH int
+	}{
+		{"", 400, 200, 400, 200},
+		{"200x200", 400, 200, 200, 100},
+		{"200x200^", 400, 200, 400, 200},
+		{"200x200!", 400, 200, 200, 200},
+		{"100", 400, 200, 100, 50},
+		{"x100", 400, 200, 200, 100},
+		{"50%", 400, 200, 200, 100},
+		{"50x25%", 400, 200, 200, 50},
+		{"800x800>", 400, 200, 400, 200},
+		{"200x200>", 400, 200, 200, 100},
+		{"200x200<", 400, 200, 400, 200},
+		{"800x800<", 400, 200, 800, 400},
+		{"20000@", 400, 200, 200, 100},
+	} {
+		g, err := Parse(v.g)
+		if err != nil {
+			t.Fatalf("error parsing '%s': %s", v.g, err)
+		}
+		if w, h := g.Size(v.w, v.h); w != v.expW || h != v.expH {
+			t.Errorf("size of '%s' on %dx%d: expected %dx%d, got %dx%d", v.g, v.w, v.h, v.expW, v.expH, w, h)
+		}
+	}
+}
+
+func TestGeometryResolve(t *testing.T) {
+	ppi := func(u string) float64 {
+		switch u {
+		case "cm":
+			return 100 / 2.54
+		case "mm":
+			return 100 / 25.4
+		}
+		return 100
+	}
+	for _, v := range []struct {
+		g                string
+		x, y, offX, offY int
+	}{
+		{"10cmx15cm+5mm+5mm", 394, 591, 20, 20},
+		{"4inx6in@300dpi", 1200, 1800, 0, 0},
+		{"4inx6in", 400, 600, 0, 0},
+		{"72ptx36pt-1in+0.5in", 100, 50, -100, 50},
+		{"100x2in+10+1cm", 100, 200, 10, 39},
+		{"2.5in", 250, 0, 0, 0},
+	} {
+		g, err := Parse(v.g)
+		if err != nil {
+			t.Fatalf("error parsing '%s': %s", v.g, err)
+		}
+		if !g.Physical() {
+			t.Errorf("expected '%s' to be physical", v.g)
+		}
+		if err = g.Resolve(ppi); err != nil {
+			t.Errorf("error resolving '%s': %s", v.g, err)
+		}
+		if g.X != v.x || g.Y != v.y || g.OffsetX != v.offX || g.OffsetY != v.offY {
+			t.Errorf("resolve of '%s': expected %d %d %d %d, got %d %d %d %d",
+				v.g, v.x, v.y, v.offX, v.offY, g.X, g.Y, g.OffsetX, g.OffsetY)
+		}
+	}
+	for _, v := range []string{"10cm%", "10cm@", "0dpi 10cm"} {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("expected an error parsing '%s'", v)
+		}
+	}
+	if g, _ := Parse("800x600"); g.Physical() {
+		t.Errorf("expected '800x600' to not be physical")
+	}
+}
+
+func TestGeometryRect(t *testing.T) {
+	b := image.Rect(0, 0, 400, 200)
+	for _, v := range []struct {
+		g   string
+		exp image.Rectangle
+	}{
+		{"", b},
+		{"100x50+10+20", image.Rect(10, 20, 110, 70)},
+		{"+10+20", image.Rect(10, 20, 400, 200)},
+		{"50%", image.Rect(0, 0, 200, 100)},
+		{"rect:10,20,110,70", image.Rect(10, 20, 110, 70)},
+		{"200x200 South", image.Rect(100, 0, 300, 200)},
+		{"100x100 SouthEast", image.Rect(300, 100, 400, 200)},
+		{"100x100+10+20 SouthEast", image.Rect(290, 80, 390, 180)},
+		{"100x100+10+20 Center", image.Rect(160, 70, 260, 170)},
+		{"100x50 North", image.Rect(150, 0, 250, 50)},
+		{"100x50 West", image.Rect(0, 75, 100, 125)},
+		{"600x300 Center", image.Rect(-100, -50, 500, 250)},
+	} {
+		g, _ := Parse(v.g)
+		if r := g.Rect(b); r != v.exp {
+			t.Errorf("rect of '%s': expected %v, got %v", v.g, v.exp, r)
+		}
+	}
 }
 
 func TestGeometry(t *testing.T) {
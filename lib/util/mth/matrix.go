@@ -3,6 +3,11 @@ package mth
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Laughs-In-Flowers/xrr"
 )
 
 type Matrix interface {
@@ -12,9 +17,53 @@ type Matrix interface {
 	MaxY() int
 }
 
-//func StringToMatrix() *M {
-//	return NewMatrix(0, 0)
-//}
+var (
+	EmptyMatrixError  = xrr.Xrror("no matrix values in '%s'").Out
+	RaggedMatrixError = xrr.Xrror("matrix row %d has %d values, expected %d").Out
+	MatrixValueError  = xrr.Xrror("unable to parse matrix value '%s': %s").Out
+)
+
+func isRowSeparator(r rune) bool {
+	return r == ';' || r == '\n'
+}
+
+func isValueSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// Parses a string of float values to a matrix, where rows are delimited by
+// ';' or a newline and values within a row by ',' or whitespace, e.g.
+// "0,-1,0;-1,5,-1;0,-1,0".
+func StringToMatrix(s string) (*M, error) {
+	var rows [][]float64
+	for _, row := range strings.FieldsFunc(s, isRowSeparator) {
+		fields := strings.FieldsFunc(row, isValueSeparator)
+		if len(fields) == 0 {
+			continue
+		}
+		vals := make([]float64, 0, len(fields))
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, MatrixValueError(f, err)
+			}
+			vals = append(vals, v)
+		}
+		rows = append(rows, vals)
+	}
+	if len(rows) == 0 {
+		return nil, EmptyMatrixError(s)
+	}
+	w, h := len(rows[0]), len(rows)
+	m := NewMatrix(w, h)
+	for y, row := range rows {
+		if len(row) != w {
+			return nil, RaggedMatrixError(y, len(row), w)
+		}
+		copy(m.MX[y*w:], row)
+	}
+	return m, nil
+}
 
 type M struct {
 	MX   []float64
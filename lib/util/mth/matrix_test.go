@@ -0,0 +1,33 @@
+package mth
+
+import "testing"
+
+func TestStringToMatrix(t *testing.T) {
+	for _, v := range []struct {
+		s    string
+		w, h int
+		at   [3]float64
+	}{
+		{"0,-1,0;-1,5,-1;0,-1,0", 3, 3, [3]float64{1, 1, 5}},
+		{"1 2 3\n4 5 6\n", 3, 2, [3]float64{2, 1, 6}},
+		{"0.5,0.25", 2, 1, [3]float64{1, 0, 0.25}},
+	} {
+		m, err := StringToMatrix(v.s)
+		if err != nil {
+			t.Errorf("'%s' unexpected error: %s", v.s, err)
+			continue
+		}
+		if m.MaxX() != v.w || m.MaxY() != v.h {
+			t.Errorf("'%s' expected %dx%d, got %dx%d", v.s, v.w, v.h, m.MaxX(), m.MaxY())
+		}
+		if a := m.At(int(v.at[0]), int(v.at[1])); a != v.at[2] {
+			t.Errorf("'%s' expected %v at (%v,%v), got %v", v.s, v.at[2], v.at[0], v.at[1], a)
+		}
+	}
+
+	for _, s := range []string{"", ";;", "1,2;3", "1,a,3"} {
+		if _, err := StringToMatrix(s); err == nil {
+			t.Errorf("'%s' expected an error", s)
+		}
+	}
+}
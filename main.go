@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"image"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/Laughs-In-Flowers/flip"
@@ -15,25 +17,22 @@ import (
 	"github.com/Laughs-In-Flowers/warhola/lib/canvas"
 	"github.com/Laughs-In-Flowers/warhola/lib/core"
 	"github.com/Laughs-In-Flowers/warhola/lib/plugin"
+	"github.com/Laughs-In-Flowers/warhola/lib/processor"
 	"github.com/Laughs-In-Flowers/warhola/lib/util/ctx"
 	"github.com/Laughs-In-Flowers/warhola/lib/util/geo"
 )
 
-var pluginDirs = []string{"plugins"}
-
+// dirs provides the default plugin directories and those of the provided
+// comma separated list, see plugin.Dirs.
 func dirs(paths string, b *bytes.Buffer) []string {
-	ret := pluginDirs
-	if paths != "" {
-		var pth string
-		var err error
-		spl := strings.Split(paths, ",")
-		for _, v := range spl {
-			pth, err = filepath.Abs(v)
-			if err != nil {
-				failure(b, "plugin dirs", err)
-			}
-			ret = append(ret, pth)
+	var ret []string
+	for _, v := range plugin.Dirs(paths) {
+		pth, err := filepath.Abs(v)
+		if err != nil {
+			failure(b, "plugin dirs", err)
+			continue
 		}
+		ret = append(ret, pth)
 	}
 	return ret
 }
@@ -52,15 +51,29 @@ func pluginSetting(a []string) {
 
 	msg := new(bytes.Buffer)
 
-	P, err = plugin.New(dirs(d, msg)...)
+	f, err := plugin.ReadFilter(plugin.ConfigPath())
 	if err != nil {
-		failure(msg, "plugins creation", err)
+		failure(msg, "plugin configuration", err)
+		f = &plugin.Filter{}
 	}
-	err = P.Load()
+
+	O.proc, err = processor.New(
+		processor.SetLogger(O.Logger),
+		processor.SetPluginDirs(dirs(d, msg)...),
+		processor.SetPluginFilter(f),
+	)
 	if err != nil {
-		failure(msg, "plugin initialization", err)
+		os.Exit(int(failure(msg, "plugin initialization", err)))
+	}
+	for _, s := range O.proc.Plugins().Status() {
+		switch s.Err {
+		case nil, plugin.DeniedError, plugin.NotAllowedError:
+		default:
+			msg.WriteString(fmt.Sprintf("plugin warning: skipping %s:\n\t%s\n", filepath.Join(s.Dir, s.File), s.Err))
+		}
 	}
-	cmds, err := P.Get("ALL")
+	writeOnce(os.Stderr, msg)
+	cmds, err := O.proc.Plugins().Get("ALL")
 	if err != nil {
 		failure(msg, "plugin command loading", err)
 	}
@@ -68,18 +81,43 @@ func pluginSetting(a []string) {
 	F.SetGroup("aux", 100, cmds...)
 }
 
+// recipeArgs rewrites 'run recipe.yaml [top options]' as
+// '[top options] run -recipe recipe.yaml', so the options of the canvas the
+// recipe runs against reach the top level command.
+func recipeArgs(a []string) []string {
+	for idx, arg := range a {
+		if arg != "run" || idx+1 >= len(a) || strings.HasPrefix(a[idx+1], "-") {
+			continue
+		}
+		ret := make([]string, 0, len(a)+1)
+		ret = append(ret, a[:idx]...)
+		ret = append(ret, a[idx+2:]...)
+		return append(ret, "run", "-recipe", a[idx+1])
+	}
+	return a
+}
+
 type Options struct {
 	*tOptions
 	*cOptions
+	*state
 }
 
 func defaultOptions() *Options {
 	return &Options{
 		&defaultTopOptions,
 		&defaultCanvasOptions,
+		&state{},
 	}
 }
 
+// The processor, geometry and canvas of an invocation.
+type state struct {
+	proc *processor.Processor
+	G    *geo.Geometry
+	CV   canvas.Canvas
+}
+
 func tExecute(o *Options, c context.Context, a []string) (context.Context, flip.ExitStatus) {
 	var status flip.ExitStatus
 	for _, fn := range executing {
@@ -127,13 +165,13 @@ func tFlags(fs *flip.FlagSet, o *Options) *flip.FlagSet {
 }
 
 func debugPush(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	c = context.WithValue(c, 0, o.Debug)
+	c = ctx.WithDebug(c, o.Debug)
 	return c, flip.ExitNo
 }
 
 func debugInfoPush(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
 	di := make(map[string]string)
-	c = context.WithValue(c, 1, di)
+	c = ctx.WithDebugMap(c, di)
 	return c, flip.ExitNo
 }
 
@@ -162,11 +200,14 @@ func debugCleanupFunc(c context.Context) {
 			l.Println("- start debug information -----")
 			if d := ctx.DebugMap(c); d != nil {
 				cv := ctx.Canvas(c)
+				to := core.NewOptions(l, O.proc.Fonts())
 				textReset(
-					core.CoreOptions,
+					to,
 					ctx.DebugMapCollapse(d),
 				)
-				core.WriteText(cv, core.CoreOptions)
+				if _, err := core.WriteText(cv, to); err != nil {
+					l.Println(err)
+				}
 				for k, v := range d {
 					l.Printf("%s: %s", k, v)
 				}
@@ -177,6 +218,9 @@ func debugCleanupFunc(c context.Context) {
 }
 
 func logSetting(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
+	if o.InFile == canvas.PATHSTDIO || o.OutFile == canvas.PATHSTDIO {
+		o.Logger = log.New(os.Stderr, log.LInfo, log.DefaultNullFormatter())
+	}
 	if o.formatter != "null" {
 		switch o.formatter {
 		case "text", "stdout":
@@ -189,12 +233,12 @@ func logSetting(o *Options, c context.Context) (context.Context, flip.ExitStatus
 }
 
 func logPush(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	c = context.WithValue(c, 2, o.Logger)
+	c = ctx.WithLog(c, o.Logger)
 	return c, flip.ExitNo
 }
 
 func pluginPush(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	c = context.WithValue(c, 3, P)
+	c = ctx.WithPlugins(c, o.proc.Plugins())
 	return c, flip.ExitNo
 }
 
@@ -205,86 +249,132 @@ type cOptions struct {
 	Geometry        string
 	PP              float64
 	PPU             string
+	Quality         int
+	PngCompression  string
+	TiffCompression string
+	TiffPredictor   bool
+	AutoOrient      bool
+	KeepMetadata    bool
+	Backup          bool
+	History         int
 }
 
 var defaultCanvasOptions = cOptions{
 	canvas.WorkingColorModelString,
 	"", "",
-	"png",
+	"",
 	"",
 	300,
 	"inch",
+	100,
+	"default",
+	"none",
+	false,
+	false,
+	false,
+	false,
+	0,
 }
 
 func cFlags(fs *flip.FlagSet, o *Options) *flip.FlagSet {
 	fs.StringVar(&o.Color, "color", o.Color, "The color model of the canvas. [ALPHA|ALPHA16|CMYK|GRAY|GRAY16|NRGBA|NRGBA64|RGBA|RGBA64]")
-	fs.StringVar(&o.InFile, "in", o.InFile, "The full path of the new or existing image")
-	fs.StringVar(&o.OutFile, "out", o.OutFile, "The path for the out file if different from the in file")
-	fs.StringVar(&o.FileType, "fileType", o.FileType, "Type of file for the canvas. [bmp|jpeg|png|tiff]")
+	fs.StringVar(&o.InFile, "in", o.InFile, "The full path of the new or existing image, or - to read standard input")
+	fs.StringVar(&o.OutFile, "out", o.OutFile, "The path for the out file if different from the in file, or - to write standard output")
+	fs.StringVar(&o.FileType, "fileType", o.FileType, "Type of file for the canvas where the out path has no extension, defaulting to the opened file type or png. [bmp|gif|jpeg|png|tiff]")
 	geo.GeometryFlag(fs, &o.Geometry, o.Geometry)
 	fs.Float64Var(&o.PP, "PP", o.PP, "points per unit where unit is specified in option PP")
 	fs.StringVar(&o.PPU, "PPU", o.PPU, "unit of measurement for points per")
+	fs.IntVar(&o.Quality, "quality", o.Quality, "JPEG encoding quality. [1-100]")
+	fs.StringVar(&o.PngCompression, "pngCompression", o.PngCompression, "PNG encoding compression level. [default|none|speed|best]")
+	fs.StringVar(&o.TiffCompression, "tiffCompression", o.TiffCompression, "TIFF encoding compression. [none|deflate|lzw]")
+	fs.BoolVar(&o.TiffPredictor, "tiffPredictor", o.TiffPredictor, "Use a differencing predictor when encoding TIFF, where supported by the compression.")
+	fs.BoolVar(&o.AutoOrient, "autoOrient", o.AutoOrient, "Rotate and flip an opened image to its EXIF orientation.")
+	fs.BoolVar(&o.KeepMetadata, "keepMetadata", o.KeepMetadata, "Carry EXIF and XMP metadata of an opened image through to a saved JPEG or TIFF.")
+	fs.BoolVar(&o.Backup, "backup", o.Backup, "Keep an existing file as name.bak when saving over it.")
+	fs.IntVar(&o.History, "history", o.History, "The number of prior canvas states kept for the history command, 0 keeps none.")
 	return fs
 }
 
 func geometrySetting(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
 	var gErr error
-	G = geo.New(o.Geometry)
+	o.G, gErr = geo.Parse(o.Geometry)
+	if gErr == nil {
+		gErr = o.G.Resolve(canvas.NewMeasure(image.Rectangle{}, o.PP, o.PPU).PP)
+	}
 	if gErr != nil {
 		o.Fatalf("geometry error: %s", gErr)
 		return nil, flip.ExitFailure
 	}
-	core.CoreOptions.SetString("default.geometry", o.Geometry)
 	return c, flip.ExitNo
 }
 
 func geometryPush(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	c = context.WithValue(c, 5, G)
+	c = ctx.WithGeometry(c, o.G)
 	return c, flip.ExitNo
 }
 
-func canvasSetting(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	var cErr error
-	ocm = o.Color
-	CV, cErr = canvas.New(canvas.SetLogger(o.Logger),
+// canvasConfig provides the configuration of a canvas by the options, for the
+// provided in and out paths.
+func canvasConfig(o *Options, in, out string) []canvas.Config {
+	pp, ppu := o.PP, o.PPU
+	if o.G.DPI > 0 {
+		pp, ppu = o.G.DPI, "inch"
+	}
+	return []canvas.Config{
+		canvas.SetLogger(o.Logger),
 		canvas.SetColorModel(canvas.WorkingColorModelString),
-		canvas.SetPath(o.InFile, o.OutFile),
+		canvas.SetPath(in, out),
 		canvas.SetFileType(o.FileType),
-		canvas.SetMeasure(o.PP, o.PPU),
-		canvas.SetRect(G.X, G.Y),
-	)
+		canvas.SetMeasure(pp, ppu),
+		canvas.SetRect(o.G.X, o.G.Y),
+		canvas.SetEncodeOptions(o.Quality, o.PngCompression, o.TiffCompression, o.TiffPredictor),
+		canvas.SetAutoOrient(o.AutoOrient),
+		canvas.SetKeepMetadata(o.KeepMetadata),
+		canvas.SetBackup(o.Backup),
+		canvas.SetHistory(o.History),
+	}
+}
+
+func canvasSetting(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
+	var cErr error
+	o.CV, cErr = canvas.New(canvasConfig(o, o.InFile, o.OutFile)...)
 	if cErr != nil {
-		CV.Printf("canvas error: %s", cErr)
+		o.Printf("canvas error: %s", cErr)
 		return nil, flip.ExitFailure
 	}
 	return c, flip.ExitNo
 }
 
 func canvasPush(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	c = context.WithValue(c, 4, CV)
+	c = ctx.WithCanvas(c, o.CV)
 	return c, flip.ExitNo
 }
 
 func canvasCleanup(o *Options, c context.Context) (context.Context, flip.ExitStatus) {
-	F.SetCleanup(flip.ExitAny, canvasCleanupFunc)
+	F.SetCleanup(flip.ExitAny, func(c context.Context) {
+		canvasCleanupFunc(o, c)
+	})
 	return c, flip.ExitNo
 }
 
-func canvasCleanupFunc(c context.Context) {
+// saveCanvas saves the canvas in the color model of the options.
+func saveCanvas(o *Options, cv canvas.Canvas) error {
+	switch o.Color {
+	case canvas.WorkingColorModelString:
+		return cv.Save()
+	default:
+		return cv.SaveTo(o.Color)
+	}
+}
+
+func canvasCleanupFunc(o *Options, c context.Context) {
 	if l := ctx.Log(c); l != nil {
 		l.Println("clean up")
-		var cuErr error
-		switch ocm {
-		case canvas.WorkingColorModelString:
-			cuErr = CV.Save()
-		default:
-			cuErr = CV.SaveTo(ocm)
-		}
-		if cuErr != nil {
+		if cuErr := saveCanvas(o, o.CV); cuErr != nil {
 			l.Printf("cleanup error: %s", cuErr)
 		}
 	} else {
-		CV.Save()
+		o.CV.Save()
 	}
 }
 
@@ -322,7 +412,7 @@ var defaultStatusOptions sOptions = sOptions{true, false, false, ""}
 
 func sFlags(fs *flip.FlagSet, o *sOptions) *flip.FlagSet {
 	fs.BoolVar(&o.all, "all", o.all, "Complete status list")
-	fs.BoolVar(&o.plugin, "plugin", o.plugin, "List of all plugins by directory")
+	fs.BoolVar(&o.plugin, "plugin", o.plugin, "List of all plugins by directory, with the version, API level and any load error of each")
 	fs.BoolVar(&o.font, "font", o.font, "List of all fonts for the specified fontsDir")
 	fs.StringVar(&o.fontDirs, "fontDirs", o.fontDirs, "The fontsDir to look in.")
 	return fs
@@ -367,30 +457,56 @@ func writeOnce(w io.Writer, msg *bytes.Buffer) {
 
 func failure(msg *bytes.Buffer, cause string, err error) flip.ExitStatus {
 	msg.WriteString(fmt.Sprintf("%s error:\n\t%s\n", cause, err))
-	writeOnce(os.Stdout, msg)
+	writeOnce(os.Stderr, msg)
 	return flip.ExitFailure
 }
 
 func writePlugins(msg *bytes.Buffer) {
-	ps, err := P.Plugins()
+	ps, err := O.proc.Plugins().Plugins()
 	if err != nil {
 		msg.WriteString(fmt.Sprintf("unable to write plugins: %s", err.Error()))
 		writeOnce(os.Stderr, msg)
 	}
+	status := make(map[string]plugin.Status)
+	for _, s := range O.proc.Plugins().Status() {
+		status[filepath.Join(s.Dir, s.File)] = s
+	}
 	msg.WriteString(fmt.Sprintf("%s\n", "available plugins"))
 	for k, v := range ps {
 		if len(v) > 0 {
 			msg.WriteString(fmt.Sprintf("\t%s\n", k))
 			for _, vv := range v {
-				msg.WriteString(fmt.Sprintf("\t\t%s\n", vv))
+				msg.WriteString(fmt.Sprintf("\t\t%s\n", pluginLine(vv, status[filepath.Join(k, vv)])))
 			}
 		}
 	}
 	writeOnce(os.Stdout, msg)
 }
 
+// pluginLine describes a plugin by its Status, where it has one.
+func pluginLine(name string, s plugin.Status) string {
+	var ret string = name
+	if m := s.Manifest; m != nil {
+		version, api := m.Version, "unknown"
+		if version == "" {
+			version = "unversioned"
+		}
+		if m.API > 0 {
+			api = strconv.Itoa(m.API)
+		}
+		ret = fmt.Sprintf("%s\t%s %s, api %s", ret, m.Name, version, api)
+		if m.Description != "" {
+			ret = fmt.Sprintf("%s: %s", ret, m.Description)
+		}
+	}
+	if s.Err != nil {
+		ret = fmt.Sprintf("%s\n\t\t\tnot loaded: %s", ret, s.Err)
+	}
+	return ret
+}
+
 func writeFonts(msg *bytes.Buffer, so *sOptions) {
-	f := core.LF
+	f := O.proc.Fonts()
 	f.SetDir(core.FontDirs(so.fontDirs)...)
 	fs := f.List()
 	msg.WriteString("available fonts\n")
@@ -408,12 +524,8 @@ var (
 )
 
 var (
-	O   *Options
-	F   flip.Flpr
-	P   plugin.Loader
-	ocm string
-	CV  canvas.Canvas
-	G   *geo.Geometry
+	O *Options
+	F flip.Flpr
 )
 
 func init() {
@@ -422,18 +534,15 @@ func init() {
 	F = flip.New("warhola")
 	F.AddBuiltIn("version", versionPackage, versionTag, versionHash, versionDate).
 		AddBuiltIn("help").
-		SetGroup("top", -1, TopCommand(), StatusCommand())
+		SetGroup("top", -1, TopCommand(), StatusCommand()).
+		SetGroup("batch", 1, BatchCommand())
 }
 
-// context contains the following key/values
-// 0 - debug boolean
-// 1 - debug info
-// 2 - log.Logger
-// 3 - plugin loaders
-// 4 - canvas
-// 5 - geometry
+// context contains a ctx.Session holding the debug boolean, debug info,
+// log.Logger, plugin loaders, canvas and geometry
 func main() {
-	pluginSetting(os.Args)
+	args := recipeArgs(os.Args)
+	pluginSetting(args)
 	c := context.Background()
-	os.Exit(F.Execute(c, os.Args))
+	os.Exit(F.Execute(c, args))
 }